@@ -0,0 +1,210 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Batch types. See https://ircv3.net/specs/extensions/batch.
+const (
+	BatchNetsplit           = "netsplit"
+	BatchNetjoin            = "netjoin"
+	BatchChatHistory        = "chathistory"
+	BatchChatHistoryTargets = "draft/chathistory-targets"
+	BatchLabeledResponse    = "labeled-response"
+	BatchMultiline          = "draft/multiline"
+)
+
+// Batch is an IRCv3 batch: messages the server groups together.
+type Batch struct {
+	// Ref is the batch's reference tag.
+	Ref string
+
+	// Type is the batch type, such as netsplit.
+	Type string
+
+	// Params are the parameters following the type.
+	Params []string
+
+	// Start is the message that opened the batch. Tags on it, such as label,
+	// apply to the whole batch.
+	Start Message
+
+	// Messages are the messages in the batch in the order they arrived.
+	//
+	// A nested batch appears as the BATCH message that opened it. Use Child to
+	// find it.
+	Messages []Message
+
+	// Children are the nested batches in the order they opened.
+	Children []*Batch
+}
+
+// NewBatch creates a batch. If ref is blank we generate one.
+//
+// This is for sending batches. Add messages to it and then send what
+// Flatten returns.
+func NewBatch(ref, batchType string, params ...string) *Batch {
+	if ref == "" {
+		ref = NewBatchRef()
+	}
+
+	start := Message{
+		Command: "BATCH",
+		Params:  append([]string{"+" + ref, batchType}, params...),
+	}
+
+	return &Batch{
+		Ref:    ref,
+		Type:   batchType,
+		Params: params,
+		Start:  start,
+	}
+}
+
+// NewBatchRef creates a random batch reference tag.
+func NewBatchRef() string {
+	return NewMsgID()[:16]
+}
+
+// Child returns the nested batch that the message opened. If the message did
+// not open a nested batch, we return nil.
+func (b *Batch) Child(m Message) *Batch {
+	if m.Command != "BATCH" || len(m.Params) == 0 ||
+		!strings.HasPrefix(m.Params[0], "+") {
+		return nil
+	}
+
+	ref := m.Params[0][1:]
+	for _, child := range b.Children {
+		if child.Ref == ref {
+			return child
+		}
+	}
+	return nil
+}
+
+// Flatten returns the messages to send the batch: the start, the messages
+// tagged with the batch's reference tag, then the end. Nested batches are
+// flattened in place.
+//
+// The prefix of the start message is used for the end message.
+func (b *Batch) Flatten() []Message {
+	msgs := []Message{b.Start}
+
+	for _, m := range b.Messages {
+		if child := b.Child(m); child != nil {
+			childMsgs := child.Flatten()
+			childMsgs[0] = childMsgs[0].WithBatch(b.Ref)
+			msgs = append(msgs, childMsgs...)
+			continue
+		}
+		msgs = append(msgs, m.WithBatch(b.Ref))
+	}
+
+	return append(msgs, Message{
+		Prefix:  b.Start.Prefix,
+		Command: "BATCH",
+		Params:  []string{"-" + b.Ref},
+	})
+}
+
+// AddChild adds a nested batch. This is for sending batches.
+func (b *Batch) AddChild(child *Batch) {
+	b.Messages = append(b.Messages, child.Start)
+	b.Children = append(b.Children, child)
+}
+
+// BatchTracker reassembles batches.
+//
+// Give it every incoming message. It holds back messages that are part of a
+// batch until the batch ends, then delivers the batch with its messages in
+// order. Batches may be nested. We deliver a nested batch as part of its
+// outermost batch.
+//
+// It is not safe for concurrent use.
+type BatchTracker struct {
+	open map[string]*Batch
+}
+
+// NewBatchTracker creates a BatchTracker.
+func NewBatchTracker() *BatchTracker {
+	return &BatchTracker{open: map[string]*Batch{}}
+}
+
+// Open returns how many batches are open.
+func (t *BatchTracker) Open() int {
+	return len(t.open)
+}
+
+// Add processes a message.
+//
+// If the message is not part of a batch we return false. Handle it as usual.
+//
+// Otherwise we hold on to it and return true. If it ends an outermost batch
+// we return the batch as well.
+//
+// A message tagged with a batch we don't know about is not part of a batch.
+func (t *BatchTracker) Add(m Message) (*Batch, bool, error) {
+	if m.Command == "BATCH" {
+		return t.batchCommand(m)
+	}
+
+	parent, ok := t.open[m.Batch()]
+	if !ok {
+		return nil, false, nil
+	}
+
+	parent.Messages = append(parent.Messages, m)
+	return nil, true, nil
+}
+
+// batchCommand processes a BATCH message.
+//
+// BATCH +<reference-tag> <type> [<parameters>...]
+// BATCH -<reference-tag>
+func (t *BatchTracker) batchCommand(m Message) (*Batch, bool, error) {
+	if len(m.Params) == 0 || len(m.Params[0]) < 2 {
+		return nil, true, fmt.Errorf("malformed BATCH: %s", m)
+	}
+
+	ref := m.Params[0][1:]
+
+	switch m.Params[0][0] {
+	case '+':
+		if len(m.Params) < 2 {
+			return nil, true, fmt.Errorf("BATCH is missing type: %s", m)
+		}
+		if _, ok := t.open[ref]; ok {
+			return nil, true, fmt.Errorf("batch %s is already open", ref)
+		}
+
+		b := &Batch{
+			Ref:    ref,
+			Type:   m.Params[1],
+			Params: m.Params[2:],
+			Start:  m,
+		}
+		t.open[ref] = b
+
+		if parent, ok := t.open[m.Batch()]; ok {
+			parent.Messages = append(parent.Messages, m)
+			parent.Children = append(parent.Children, b)
+		}
+		return nil, true, nil
+	case '-':
+		b, ok := t.open[ref]
+		if !ok {
+			return nil, true, fmt.Errorf("batch %s is not open", ref)
+		}
+		delete(t.open, ref)
+
+		// A nested batch is delivered with its parent.
+		if _, ok := t.open[b.Start.Batch()]; ok {
+			return nil, true, nil
+		}
+		return b, true, nil
+	default:
+		return nil, true, fmt.Errorf("malformed BATCH: %s", m)
+	}
+}
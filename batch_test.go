@@ -0,0 +1,163 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatchTracker(t *testing.T) {
+	lines := []string{
+		"@label=abc :irc BATCH +outer labeled-response\r\n",
+		"@batch=outer :irc BATCH +inner netsplit irc.hub.example irc.leaf.example\r\n",
+		"@batch=inner :alice!a@h QUIT :irc.hub.example irc.leaf.example\r\n",
+		// Not part of a batch.
+		":bob!b@h PRIVMSG #test :hi\r\n",
+		"@batch=outer :irc 001 me :between\r\n",
+		"@batch=inner :bob!b@h QUIT :irc.hub.example irc.leaf.example\r\n",
+		":irc BATCH -inner\r\n",
+		"@batch=outer :irc NOTICE me :last\r\n",
+		":irc BATCH -outer\r\n",
+	}
+
+	tracker := NewBatchTracker()
+
+	var msgs []Message
+	var got *Batch
+	for i, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+		msgs = append(msgs, m)
+
+		b, held, err := tracker.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+
+		if wantHeld := i != 3; held != wantHeld {
+			t.Errorf("Add(%s) held = %v, wanted %v", m, held, wantHeld)
+		}
+
+		if b != nil {
+			if i != len(lines)-1 {
+				t.Fatalf("Add(%s) completed a batch early", m)
+			}
+			got = b
+		}
+	}
+
+	if got == nil {
+		t.Fatalf("batch did not complete")
+	}
+	if tracker.Open() != 0 {
+		t.Errorf("Open() = %d, wanted 0", tracker.Open())
+	}
+
+	if got.Ref != "outer" || got.Type != BatchLabeledResponse ||
+		got.Start.Label() != "abc" {
+		t.Errorf("batch is %+v", got)
+	}
+
+	wantMsgs := []Message{msgs[1], msgs[4], msgs[7]}
+	if !reflect.DeepEqual(got.Messages, wantMsgs) {
+		t.Errorf("batch messages = %v, wanted %v", got.Messages, wantMsgs)
+	}
+
+	inner := got.Child(got.Messages[0])
+	if inner == nil {
+		t.Fatalf("nested batch not found")
+	}
+
+	if inner.Type != BatchNetsplit ||
+		!reflect.DeepEqual(inner.Params,
+			[]string{"irc.hub.example", "irc.leaf.example"}) {
+		t.Errorf("nested batch is %+v", inner)
+	}
+
+	wantInner := []Message{msgs[2], msgs[5]}
+	if !reflect.DeepEqual(inner.Messages, wantInner) {
+		t.Errorf("nested batch messages = %v, wanted %v", inner.Messages,
+			wantInner)
+	}
+}
+
+func TestBatchTrackerErrors(t *testing.T) {
+	tests := []struct {
+		lines []string
+	}{
+		{[]string{"BATCH\r\n"}},
+		{[]string{"BATCH +\r\n"}},
+		{[]string{"BATCH +a\r\n"}},
+		{[]string{"BATCH -a\r\n"}},
+		{[]string{"BATCH +a netsplit\r\n", "BATCH +a netsplit\r\n"}},
+		{[]string{"BATCH *a\r\n"}},
+	}
+
+	for _, test := range tests {
+		tracker := NewBatchTracker()
+
+		var err error
+		for _, line := range test.lines {
+			m, perr := ParseMessage(line)
+			if perr != nil {
+				t.Fatalf("ParseMessage(%q) = %s", line, perr)
+			}
+			_, _, err = tracker.Add(m)
+		}
+
+		if err == nil {
+			t.Errorf("Add(%q) succeeded, wanted error", test.lines)
+		}
+	}
+}
+
+func TestBatchFlatten(t *testing.T) {
+	b := NewBatch("outer", BatchChatHistory, "#test")
+	b.Messages = append(b.Messages, Message{Command: "PRIVMSG",
+		Params: []string{"#test", "one"}})
+
+	inner := NewBatch("inner", BatchMultiline, "#test")
+	inner.Messages = append(inner.Messages, Message{Command: "PRIVMSG",
+		Params: []string{"#test", "two"}})
+	b.AddChild(inner)
+
+	var got []string
+	for _, m := range b.Flatten() {
+		buf, err := m.Encode()
+		if err != nil {
+			t.Fatalf("Encode(%s) = %s", m, err)
+		}
+		got = append(got, buf)
+	}
+
+	want := []string{
+		"BATCH +outer chathistory #test\r\n",
+		"@batch=outer PRIVMSG #test one\r\n",
+		"@batch=outer BATCH +inner draft/multiline #test\r\n",
+		"@batch=inner PRIVMSG #test two\r\n",
+		"BATCH -inner\r\n",
+		"BATCH -outer\r\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flatten() = %q, wanted %q", got, want)
+	}
+
+	// Feeding the result back gives us the same structure.
+	tracker := NewBatchTracker()
+	var result *Batch
+	for _, m := range b.Flatten() {
+		got, _, err := tracker.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+		if got != nil {
+			result = got
+		}
+	}
+
+	if result == nil || len(result.Children) != 1 ||
+		len(result.Children[0].Messages) != 1 {
+		t.Errorf("reassembled batch is %+v", result)
+	}
+}
@@ -0,0 +1,284 @@
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CapVersion is the CAP LS version we negotiate with.
+const CapVersion = "302"
+
+// CapNegotiator runs client side IRCv3 capability negotiation.
+//
+// It does no I/O. Give it each message from the server with Handle and send
+// the messages it returns. Begin by sending the message from Start, then
+// register (NICK/USER) as usual. The server holds registration until we send
+// CAP END, which Handle returns once negotiation is complete.
+//
+// After registration it continues to handle CAP NEW and CAP DEL. When
+// capabilities we want become available we request them.
+type CapNegotiator struct {
+	want map[string]struct{}
+
+	// available holds the capabilities the server offers and their values.
+	available map[string]string
+
+	// enabled holds the capabilities we have enabled and their values.
+	enabled map[string]string
+
+	// pending holds capabilities we requested that we have no answer for.
+	pending map[string]struct{}
+
+	// ls holds capabilities from a multi-line LS we have not seen the end of.
+	ls map[string]string
+
+	lsDone bool
+	ended  bool
+	holds  int
+}
+
+// NewCapNegotiator creates a CapNegotiator that requests the given
+// capabilities if the server offers them.
+func NewCapNegotiator(want []string) *CapNegotiator {
+	n := &CapNegotiator{
+		want:      map[string]struct{}{},
+		available: map[string]string{},
+		enabled:   map[string]string{},
+		pending:   map[string]struct{}{},
+	}
+	for _, c := range want {
+		n.want[c] = struct{}{}
+	}
+	return n
+}
+
+// Start returns the message that begins negotiation.
+func (n *CapNegotiator) Start() Message {
+	return Message{Command: "CAP", Params: []string{"LS", CapVersion}}
+}
+
+// Done returns true once negotiation is complete, meaning we sent CAP END or
+// the server does not support capabilities.
+func (n *CapNegotiator) Done() bool {
+	return n.ended
+}
+
+// Hold delays ending negotiation until a matching call to Release. Use this
+// to do something before registration completes, such as SASL
+// authentication.
+func (n *CapNegotiator) Hold() {
+	n.holds++
+}
+
+// Release undoes a call to Hold. If negotiation is otherwise complete, we
+// return the CAP END message to send.
+func (n *CapNegotiator) Release() []Message {
+	if n.holds > 0 {
+		n.holds--
+	}
+	return n.maybeEnd()
+}
+
+// Enabled returns true if the capability is enabled.
+func (n *CapNegotiator) Enabled(name string) bool {
+	_, ok := n.enabled[name]
+	return ok
+}
+
+// Value returns the value of an enabled capability. For example for sasl it
+// might be "PLAIN,EXTERNAL". If the capability is not enabled we return
+// false.
+func (n *CapNegotiator) Value(name string) (string, bool) {
+	v, ok := n.enabled[name]
+	return v, ok
+}
+
+// EnabledCaps returns the enabled capabilities and their values.
+func (n *CapNegotiator) EnabledCaps() map[string]string {
+	caps := map[string]string{}
+	for k, v := range n.enabled {
+		caps[k] = v
+	}
+	return caps
+}
+
+// Available returns the capabilities the server offers and their values.
+func (n *CapNegotiator) Available() map[string]string {
+	caps := map[string]string{}
+	for k, v := range n.available {
+		caps[k] = v
+	}
+	return caps
+}
+
+// Handle processes a message from the server. It returns the messages to send
+// in response, if any.
+//
+// Messages that are not related to capability negotiation are ignored, with
+// one exception: If the server rejects CAP as an unknown command or
+// registration completes, we consider negotiation done.
+func (n *CapNegotiator) Handle(m Message) ([]Message, error) {
+	switch m.Command {
+	case "CAP":
+	case ReplyWelcome:
+		n.ended = true
+		return nil, nil
+	case ErrorUnknownCommand:
+		if len(m.Params) > 1 && strings.ToUpper(m.Params[1]) == "CAP" {
+			n.ended = true
+		}
+		return nil, nil
+	default:
+		return nil, nil
+	}
+
+	// <target> <subcommand> [*] :<caps>
+	if len(m.Params) < 3 {
+		return nil, fmt.Errorf("malformed CAP message: %s", m)
+	}
+
+	subcommand := strings.ToUpper(m.Params[1])
+	more := len(m.Params) > 3 && m.Params[2] == "*"
+	caps := parseCapList(m.Params[len(m.Params)-1])
+
+	switch subcommand {
+	case "LS":
+		return n.handleLS(caps, more), nil
+	case "ACK":
+		for name, value := range caps {
+			delete(n.pending, strings.TrimPrefix(name, "-"))
+			if strings.HasPrefix(name, "-") {
+				delete(n.enabled, name[1:])
+				continue
+			}
+			if value == "" {
+				value = n.available[name]
+			}
+			n.enabled[name] = value
+		}
+		return n.maybeEnd(), nil
+	case "NAK":
+		for name := range caps {
+			delete(n.pending, strings.TrimPrefix(name, "-"))
+		}
+		return n.maybeEnd(), nil
+	case "NEW":
+		for name, value := range caps {
+			n.available[name] = value
+		}
+		return n.request(caps), nil
+	case "DEL":
+		for name := range caps {
+			delete(n.available, name)
+			delete(n.enabled, name)
+			delete(n.pending, name)
+		}
+		return nil, nil
+	case "LIST":
+		// We only learn what is enabled from this. We track that ourselves.
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown CAP subcommand: %s", subcommand)
+	}
+}
+
+// handleLS processes one line of a CAP LS reply. If this completes the
+// listing we request what we want.
+func (n *CapNegotiator) handleLS(caps map[string]string, more bool) []Message {
+	if n.ls == nil {
+		n.ls = map[string]string{}
+	}
+	for name, value := range caps {
+		n.ls[name] = value
+	}
+
+	if more {
+		return nil
+	}
+
+	for name, value := range n.ls {
+		n.available[name] = value
+	}
+	n.ls = nil
+
+	if n.lsDone {
+		return nil
+	}
+	n.lsDone = true
+
+	msgs := n.request(n.available)
+	return append(msgs, n.maybeEnd()...)
+}
+
+// request returns CAP REQ messages for the capabilities we want from those
+// given that we have not already enabled or requested.
+//
+// We send as many capabilities in each message as fit in MaxLineLength.
+func (n *CapNegotiator) request(caps map[string]string) []Message {
+	var names []string
+	for name := range caps {
+		if _, ok := n.want[name]; !ok {
+			continue
+		}
+		if _, ok := n.enabled[name]; ok {
+			continue
+		}
+		if _, ok := n.pending[name]; ok {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// CAP REQ :<caps>\r\n
+	overhead := len("CAP REQ :") + 2
+
+	var msgs []Message
+	line := ""
+	for _, name := range names {
+		n.pending[name] = struct{}{}
+
+		if line != "" && overhead+len(line)+1+len(name) > MaxLineLength {
+			msgs = append(msgs, Message{Command: "CAP",
+				Params: []string{"REQ", line}})
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+		line += name
+	}
+
+	if line != "" {
+		msgs = append(msgs, Message{Command: "CAP", Params: []string{"REQ", line}})
+	}
+
+	return msgs
+}
+
+// maybeEnd returns CAP END if negotiation is complete.
+func (n *CapNegotiator) maybeEnd() []Message {
+	if n.ended || !n.lsDone || len(n.pending) > 0 || n.holds > 0 {
+		return nil
+	}
+	n.ended = true
+	return []Message{{Command: "CAP", Params: []string{"END"}}}
+}
+
+// parseCapList parses a space separated list of capabilities, each
+// optionally with a value (name=value).
+func parseCapList(s string) map[string]string {
+	caps := map[string]string{}
+	for _, field := range strings.Fields(s) {
+		name := field
+		value := ""
+		if idx := strings.IndexByte(field, '='); idx != -1 {
+			name = field[:idx]
+			value = field[idx+1:]
+		}
+		caps[name] = value
+	}
+	return caps
+}
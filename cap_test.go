@@ -0,0 +1,198 @@
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// feedCaps gives each line to the negotiator and returns the encoded messages
+// it wants to send.
+func feedCaps(t *testing.T, n *CapNegotiator, lines ...string) []string {
+	var out []string
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		msgs, err := n.Handle(m)
+		if err != nil {
+			t.Fatalf("Handle(%s) = %s", m, err)
+		}
+
+		for _, msg := range msgs {
+			buf, err := msg.Encode()
+			if err != nil {
+				t.Fatalf("Encode(%s) = %s", msg, err)
+			}
+			out = append(out, buf)
+		}
+	}
+	return out
+}
+
+func TestCapNegotiator(t *testing.T) {
+	n := NewCapNegotiator([]string{"sasl", "server-time", "multi-prefix",
+		"away-notify", "echo-message"})
+
+	start, err := n.Start().Encode()
+	if err != nil {
+		t.Fatalf("Encode() = %s", err)
+	}
+	if start != "CAP LS 302\r\n" {
+		t.Errorf("Start() = %q", start)
+	}
+
+	// Multi-line LS. We must wait for the final line.
+	out := feedCaps(t, n,
+		":irc CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL server-time\r\n")
+	if len(out) != 0 {
+		t.Fatalf("sent %q before LS finished", out)
+	}
+
+	out = feedCaps(t, n, ":irc CAP * LS :away-notify account-tag\r\n")
+	want := []string{"CAP REQ :away-notify multi-prefix sasl server-time\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("after LS sent %q, wanted %q", out, want)
+	}
+
+	out = feedCaps(t, n, ":irc CAP * ACK :away-notify multi-prefix sasl server-time\r\n")
+	want = []string{"CAP END\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("after ACK sent %q, wanted %q", out, want)
+	}
+
+	if !n.Done() {
+		t.Errorf("negotiation should be done")
+	}
+
+	if v, ok := n.Value("sasl"); !ok || v != "PLAIN,EXTERNAL" {
+		t.Errorf("Value(sasl) = %q, %v", v, ok)
+	}
+	if n.Enabled("account-tag") {
+		t.Errorf("account-tag should not be enabled")
+	}
+
+	// Capabilities change after registration.
+	out = feedCaps(t, n,
+		":irc 001 me :Welcome\r\n",
+		":irc CAP me NEW :echo-message batch\r\n",
+	)
+	want = []string{"CAP REQ echo-message\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("after NEW sent %q, wanted %q", out, want)
+	}
+
+	out = feedCaps(t, n,
+		":irc CAP me ACK echo-message\r\n",
+		":irc CAP me DEL :sasl\r\n",
+	)
+	if len(out) != 0 {
+		t.Fatalf("sent %q after ACK/DEL", out)
+	}
+
+	wantEnabled := map[string]string{"away-notify": "", "multi-prefix": "",
+		"server-time": "", "echo-message": ""}
+	if got := n.EnabledCaps(); !reflect.DeepEqual(got, wantEnabled) {
+		t.Errorf("EnabledCaps() = %v, wanted %v", got, wantEnabled)
+	}
+}
+
+func TestCapNegotiatorNAK(t *testing.T) {
+	n := NewCapNegotiator([]string{"sasl", "server-time"})
+
+	out := feedCaps(t, n,
+		":irc CAP * LS :sasl server-time\r\n",
+		":irc CAP * NAK :sasl server-time\r\n",
+	)
+	want := []string{"CAP REQ :sasl server-time\r\n", "CAP END\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("sent %q, wanted %q", out, want)
+	}
+
+	if len(n.EnabledCaps()) != 0 {
+		t.Errorf("EnabledCaps() = %v, wanted none", n.EnabledCaps())
+	}
+}
+
+func TestCapNegotiatorNothingWanted(t *testing.T) {
+	n := NewCapNegotiator([]string{"sasl"})
+
+	out := feedCaps(t, n, ":irc CAP * LS :server-time\r\n")
+	want := []string{"CAP END\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("sent %q, wanted %q", out, want)
+	}
+}
+
+func TestCapNegotiatorHold(t *testing.T) {
+	n := NewCapNegotiator([]string{"sasl"})
+	n.Hold()
+
+	out := feedCaps(t, n,
+		":irc CAP * LS :sasl\r\n",
+		":irc CAP * ACK :sasl\r\n",
+	)
+	want := []string{"CAP REQ sasl\r\n"}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("sent %q, wanted %q", out, want)
+	}
+
+	msgs := n.Release()
+	if len(msgs) != 1 || msgs[0].Params[0] != "END" {
+		t.Errorf("Release() = %v, wanted CAP END", msgs)
+	}
+}
+
+func TestCapNegotiatorUnsupported(t *testing.T) {
+	n := NewCapNegotiator([]string{"sasl"})
+
+	out := feedCaps(t, n, ":irc 421 me CAP :Unknown command\r\n")
+	if len(out) != 0 || !n.Done() {
+		t.Errorf("sent %q, done %v", out, n.Done())
+	}
+}
+
+// Requests that do not fit in one line get split over several.
+func TestCapNegotiatorLongRequest(t *testing.T) {
+	var caps []string
+	for i := 0; i < 60; i++ {
+		caps = append(caps, "vendor.example/capability-"+strings.Repeat("x", i%5))
+		caps[i] += string(rune('a'+i%26)) + string(rune('a'+i/26))
+	}
+
+	// The server has to split its listing too.
+	var lines []string
+	for i := 0; i < len(caps); i += 12 {
+		more := "* "
+		if i+12 >= len(caps) {
+			more = ""
+		}
+		lines = append(lines,
+			":irc CAP * LS "+more+":"+strings.Join(caps[i:i+12], " ")+"\r\n")
+	}
+
+	n := NewCapNegotiator(caps)
+	out := feedCaps(t, n, lines...)
+
+	if len(out) < 2 {
+		t.Fatalf("sent %d messages, wanted several", len(out))
+	}
+
+	requested := 0
+	for _, line := range out {
+		if len(line) > MaxLineLength {
+			t.Errorf("line is %d bytes: %q", len(line), line)
+		}
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+		requested += len(strings.Fields(m.Params[1]))
+	}
+
+	if requested != len(caps) {
+		t.Errorf("requested %d capabilities, wanted %d", requested, len(caps))
+	}
+}
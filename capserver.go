@@ -0,0 +1,322 @@
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Capability describes a capability a server offers.
+type Capability struct {
+	Name string
+
+	// Value is advertised to clients that negotiate with version 302 or later,
+	// as name=value. For example "PLAIN,EXTERNAL" for sasl. It may be blank.
+	Value string
+
+	// Requires lists capabilities that must be enabled for this one to be
+	// enabled. They may be requested in the same CAP REQ.
+	Requires []string
+}
+
+// CapRegistry holds the capabilities a server offers.
+//
+// It is safe for concurrent use. Typically a server has one registry shared by
+// every connection.
+type CapRegistry struct {
+	mu   sync.RWMutex
+	caps map[string]Capability
+}
+
+// NewCapRegistry creates a registry offering the given capabilities.
+func NewCapRegistry(caps ...Capability) *CapRegistry {
+	r := &CapRegistry{caps: map[string]Capability{}}
+	for _, c := range caps {
+		r.caps[c.Name] = c
+	}
+	return r
+}
+
+// Add adds or replaces a capability.
+//
+// To tell clients about it, send each client what ClientCaps.NotifyNew
+// returns.
+func (r *CapRegistry) Add(c Capability) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caps[c.Name] = c
+}
+
+// Remove removes a capability. It returns false if there was no such
+// capability.
+//
+// To tell clients about it, send each client what ClientCaps.NotifyDel
+// returns.
+func (r *CapRegistry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.caps[name]
+	delete(r.caps, name)
+	return ok
+}
+
+// Get returns the capability with the given name.
+func (r *CapRegistry) Get(name string) (Capability, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.caps[name]
+	return c, ok
+}
+
+// list returns the capabilities sorted by name.
+func (r *CapRegistry) list() []Capability {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	caps := make([]Capability, 0, len(r.caps))
+	for _, c := range r.caps {
+		caps = append(caps, c)
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i].Name < caps[j].Name })
+	return caps
+}
+
+// ClientCaps tracks capability negotiation for a single client connection.
+//
+// It does no I/O. Give it each CAP command the client sends with Handle and
+// send the client the messages it returns.
+//
+// It is not safe for concurrent use.
+type ClientCaps struct {
+	registry   *CapRegistry
+	serverName string
+
+	// version is the CAP LS version the client sent. 0 if it has not sent
+	// CAP LS.
+	version int
+
+	// negotiating is true while the client has started negotiation but not
+	// sent CAP END.
+	negotiating bool
+
+	enabled map[string]struct{}
+}
+
+// NewClientCaps creates a ClientCaps for a new connection. serverName is used
+// as the prefix of replies.
+func NewClientCaps(registry *CapRegistry, serverName string) *ClientCaps {
+	return &ClientCaps{
+		registry:   registry,
+		serverName: serverName,
+		enabled:    map[string]struct{}{},
+	}
+}
+
+// Holding returns true if registration must wait. This is the case after the
+// client starts negotiation (CAP LS or CAP REQ) until it sends CAP END.
+func (c *ClientCaps) Holding() bool {
+	return c.negotiating
+}
+
+// Version returns the CAP LS version the client sent. It is 0 if the client
+// has not sent CAP LS, and 301 if it sent CAP LS without a version.
+func (c *ClientCaps) Version() int {
+	return c.version
+}
+
+// Enabled returns true if the client enabled the capability.
+func (c *ClientCaps) Enabled(name string) bool {
+	_, ok := c.enabled[name]
+	return ok
+}
+
+// EnabledCaps returns the names of the client's enabled capabilities, sorted.
+func (c *ClientCaps) EnabledCaps() []string {
+	var names []string
+	for name := range c.enabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// notify returns true if the client wants CAP NEW and CAP DEL. Version 302
+// implies cap-notify.
+func (c *ClientCaps) notify() bool {
+	return c.version >= 302 || c.Enabled("cap-notify")
+}
+
+// Handle processes a CAP command from the client. nick is the client's nick,
+// or "*" if it does not have one yet. It returns the replies to send.
+func (c *ClientCaps) Handle(m Message, nick string) ([]Message, error) {
+	if m.Command != "CAP" {
+		return nil, fmt.Errorf("not a CAP command: %s", m.Command)
+	}
+
+	if nick == "" {
+		nick = "*"
+	}
+
+	if len(m.Params) == 0 {
+		return []Message{c.reply(ErrorNeedMoreParams, nick, "CAP",
+			"Not enough parameters")}, nil
+	}
+
+	subcommand := strings.ToUpper(m.Params[0])
+
+	switch subcommand {
+	case "LS":
+		c.negotiating = true
+
+		version := 301
+		if len(m.Params) > 1 {
+			v, err := strconv.Atoi(m.Params[1])
+			if err == nil && v > version {
+				version = v
+			}
+		}
+		if version > c.version {
+			c.version = version
+		}
+
+		var names []string
+		for _, capability := range c.registry.list() {
+			if c.version >= 302 && capability.Value != "" {
+				names = append(names, capability.Name+"="+capability.Value)
+				continue
+			}
+			names = append(names, capability.Name)
+		}
+		return c.listReplies(nick, "LS", names), nil
+	case "LIST":
+		return c.listReplies(nick, "LIST", c.EnabledCaps()), nil
+	case "REQ":
+		c.negotiating = true
+
+		if len(m.Params) < 2 {
+			return []Message{c.reply(ErrorNeedMoreParams, nick, "CAP",
+				"Not enough parameters")}, nil
+		}
+
+		if c.request(m.Params[1]) {
+			return []Message{c.reply("CAP", nick, "ACK", m.Params[1])}, nil
+		}
+		return []Message{c.reply("CAP", nick, "NAK", m.Params[1])}, nil
+	case "END":
+		c.negotiating = false
+		return nil, nil
+	default:
+		return []Message{c.reply(ErrorInvalidCapCmd, nick, m.Params[0],
+			"Invalid CAP command")}, nil
+	}
+}
+
+// request applies a CAP REQ. Either every change in the request is made or
+// none are. It returns whether it made the changes.
+func (c *ClientCaps) request(list string) bool {
+	fields := strings.Fields(list)
+	if len(fields) == 0 {
+		return false
+	}
+
+	enabled := map[string]struct{}{}
+	for name := range c.enabled {
+		enabled[name] = struct{}{}
+	}
+
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			delete(enabled, field[1:])
+			continue
+		}
+
+		if _, ok := c.registry.Get(field); !ok {
+			return false
+		}
+		enabled[field] = struct{}{}
+	}
+
+	// Check dependencies once the whole request is applied.
+	for name := range enabled {
+		capability, ok := c.registry.Get(name)
+		if !ok {
+			continue
+		}
+		for _, required := range capability.Requires {
+			if _, ok := enabled[required]; !ok {
+				return false
+			}
+		}
+	}
+
+	c.enabled = enabled
+	return true
+}
+
+// listReplies creates the replies for LS or LIST. If the names do not fit in
+// one message and the client supports it, we use multiple messages with all
+// but the last marked with *.
+func (c *ClientCaps) listReplies(nick, subcommand string,
+	names []string) []Message {
+	// :<server> CAP <nick> <subcommand> * :<caps>\r\n
+	overhead := 1 + len(c.serverName) + len(" CAP ") + len(nick) + 1 +
+		len(subcommand) + len(" * :") + 2
+
+	var lines []string
+	line := ""
+	for _, name := range names {
+		if line != "" && overhead+len(line)+1+len(name) > MaxLineLength &&
+			c.version >= 302 {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += name
+	}
+	lines = append(lines, line)
+
+	var msgs []Message
+	for i, line := range lines {
+		if i+1 < len(lines) {
+			msgs = append(msgs, c.reply("CAP", nick, subcommand, "*", line))
+			continue
+		}
+		msgs = append(msgs, c.reply("CAP", nick, subcommand, line))
+	}
+	return msgs
+}
+
+// NotifyNew returns the CAP NEW message to tell the client about a capability
+// that became available. If the client did not ask for notifications we
+// return nothing.
+func (c *ClientCaps) NotifyNew(capability Capability, nick string) []Message {
+	if !c.notify() {
+		return nil
+	}
+
+	name := capability.Name
+	if c.version >= 302 && capability.Value != "" {
+		name += "=" + capability.Value
+	}
+	return []Message{c.reply("CAP", nick, "NEW", name)}
+}
+
+// NotifyDel returns the CAP DEL message to tell the client a capability is no
+// longer available. We disable the capability for the client whether or not
+// it asked for notifications. If it did not, we return nothing.
+func (c *ClientCaps) NotifyDel(name, nick string) []Message {
+	delete(c.enabled, name)
+
+	if !c.notify() {
+		return nil
+	}
+	return []Message{c.reply("CAP", nick, "DEL", name)}
+}
+
+func (c *ClientCaps) reply(command string, params ...string) Message {
+	return Message{Prefix: c.serverName, Command: command, Params: params}
+}
@@ -0,0 +1,231 @@
+package irc
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// handleCaps gives each line to the ClientCaps and returns the encoded
+// replies.
+func handleCaps(t *testing.T, c *ClientCaps, lines ...string) []string {
+	var out []string
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		msgs, err := c.Handle(m, "nick")
+		if err != nil {
+			t.Fatalf("Handle(%s) = %s", m, err)
+		}
+
+		for _, msg := range msgs {
+			buf, err := msg.Encode()
+			if err != nil {
+				t.Fatalf("Encode(%s) = %s", msg, err)
+			}
+			out = append(out, buf)
+		}
+	}
+	return out
+}
+
+func newTestCapRegistry() *CapRegistry {
+	return NewCapRegistry(
+		Capability{Name: "sasl", Value: "PLAIN,EXTERNAL"},
+		Capability{Name: "server-time"},
+		Capability{Name: "batch"},
+		Capability{Name: "draft/multiline", Value: "max-bytes=4096",
+			Requires: []string{"batch"}},
+	)
+}
+
+func TestClientCapsLS(t *testing.T) {
+	tests := []struct {
+		input  string
+		output []string
+	}{
+		{
+			"CAP LS\r\n",
+			[]string{":irc CAP nick LS :batch draft/multiline sasl server-time\r\n"},
+		},
+		{
+			"CAP LS 302\r\n",
+			[]string{":irc CAP nick LS :batch draft/multiline=max-bytes=4096 " +
+				"sasl=PLAIN,EXTERNAL server-time\r\n"},
+		},
+	}
+
+	for _, test := range tests {
+		c := NewClientCaps(newTestCapRegistry(), "irc")
+
+		got := handleCaps(t, c, test.input)
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("Handle(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+
+		if !c.Holding() {
+			t.Errorf("registration should be held after %q", test.input)
+		}
+	}
+}
+
+func TestClientCapsLSMultiline(t *testing.T) {
+	registry := NewCapRegistry()
+	for i := 0; i < 50; i++ {
+		registry.Add(Capability{Name: fmt.Sprintf("vendor.example/cap-%02d", i)})
+	}
+
+	c := NewClientCaps(registry, "irc.example.com")
+	out := handleCaps(t, c, "CAP LS 302\r\n")
+
+	if len(out) < 2 {
+		t.Fatalf("got %d lines, wanted several", len(out))
+	}
+
+	count := 0
+	for i, line := range out {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		last := i+1 == len(out)
+		if last && len(m.Params) != 3 {
+			t.Errorf("last line %q should not have *", line)
+		}
+		if !last && (len(m.Params) != 4 || m.Params[2] != "*") {
+			t.Errorf("line %q should have *", line)
+		}
+
+		count += len(parseCapList(m.Params[len(m.Params)-1]))
+	}
+
+	if count != 50 {
+		t.Errorf("listed %d capabilities, wanted 50", count)
+	}
+}
+
+func TestClientCapsREQ(t *testing.T) {
+	c := NewClientCaps(newTestCapRegistry(), "irc")
+
+	tests := []struct {
+		input   string
+		output  []string
+		enabled []string
+	}{
+		{
+			"CAP REQ :sasl server-time\r\n",
+			[]string{":irc CAP nick ACK :sasl server-time\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+
+		// Unknown capabilities reject the whole request.
+		{
+			"CAP REQ :batch unknown\r\n",
+			[]string{":irc CAP nick NAK :batch unknown\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+
+		// Missing dependency.
+		{
+			"CAP REQ draft/multiline\r\n",
+			[]string{":irc CAP nick NAK draft/multiline\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+
+		// Dependency in the same request.
+		{
+			"CAP REQ :draft/multiline batch\r\n",
+			[]string{":irc CAP nick ACK :draft/multiline batch\r\n"},
+			[]string{"batch", "draft/multiline", "sasl", "server-time"},
+		},
+
+		// Can't disable something another capability needs.
+		{
+			"CAP REQ -batch\r\n",
+			[]string{":irc CAP nick NAK -batch\r\n"},
+			[]string{"batch", "draft/multiline", "sasl", "server-time"},
+		},
+		{
+			"CAP REQ :-batch -draft/multiline\r\n",
+			[]string{":irc CAP nick ACK :-batch -draft/multiline\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+		{
+			"CAP LIST\r\n",
+			[]string{":irc CAP nick LIST :sasl server-time\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+		{
+			"CAP BOGUS\r\n",
+			[]string{":irc 410 nick BOGUS :Invalid CAP command\r\n"},
+			[]string{"sasl", "server-time"},
+		},
+	}
+
+	for _, test := range tests {
+		got := handleCaps(t, c, test.input)
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("Handle(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+
+		if !reflect.DeepEqual(c.EnabledCaps(), test.enabled) {
+			t.Errorf("after %q enabled %q, wanted %q", test.input,
+				c.EnabledCaps(), test.enabled)
+		}
+	}
+
+	if !c.Holding() {
+		t.Errorf("registration should be held before CAP END")
+	}
+
+	handleCaps(t, c, "CAP END\r\n")
+
+	if c.Holding() {
+		t.Errorf("registration should not be held after CAP END")
+	}
+}
+
+func TestClientCapsNotify(t *testing.T) {
+	registry := newTestCapRegistry()
+
+	c302 := NewClientCaps(registry, "irc")
+	handleCaps(t, c302, "CAP LS 302\r\n", "CAP REQ sasl\r\n", "CAP END\r\n")
+
+	c301 := NewClientCaps(registry, "irc")
+	handleCaps(t, c301, "CAP LS\r\n", "CAP REQ sasl\r\n", "CAP END\r\n")
+
+	capability := Capability{Name: "account-tag", Value: "x"}
+	registry.Add(capability)
+
+	got := c302.NotifyNew(capability, "nick")
+	want := []Message{{Prefix: "irc", Command: "CAP",
+		Params: []string{"nick", "NEW", "account-tag=x"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NotifyNew() = %v, wanted %v", got, want)
+	}
+
+	if got := c301.NotifyNew(capability, "nick"); got != nil {
+		t.Errorf("NotifyNew() = %v for client without cap-notify", got)
+	}
+
+	registry.Remove("sasl")
+
+	got = c302.NotifyDel("sasl", "nick")
+	want = []Message{{Prefix: "irc", Command: "CAP",
+		Params: []string{"nick", "DEL", "sasl"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NotifyDel() = %v, wanted %v", got, want)
+	}
+
+	if got := c301.NotifyDel("sasl", "nick"); got != nil {
+		t.Errorf("NotifyDel() = %v for client without cap-notify", got)
+	}
+
+	if c302.Enabled("sasl") || c301.Enabled("sasl") {
+		t.Errorf("sasl should be disabled")
+	}
+}
@@ -0,0 +1,259 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CHATHISTORY subcommands. See
+// https://ircv3.net/specs/extensions/chathistory.
+const (
+	HistoryLatest  = "LATEST"
+	HistoryBefore  = "BEFORE"
+	HistoryAfter   = "AFTER"
+	HistoryAround  = "AROUND"
+	HistoryBetween = "BETWEEN"
+	HistoryTargets = "TARGETS"
+)
+
+// HistorySelector selects a point in a conversation's history, either by
+// message ID or by time. The zero value is the * selector, meaning no
+// particular point.
+type HistorySelector struct {
+	MsgID string
+	Time  time.Time
+}
+
+// MsgIDSelector selects the message with the ID.
+func MsgIDSelector(id string) HistorySelector {
+	return HistorySelector{MsgID: id}
+}
+
+// TimeSelector selects the time.
+func TimeSelector(t time.Time) HistorySelector {
+	return HistorySelector{Time: t}
+}
+
+// IsZero returns true for the * selector.
+func (s HistorySelector) IsZero() bool {
+	return s.MsgID == "" && s.Time.IsZero()
+}
+
+// String returns the selector as a CHATHISTORY parameter: msgid=<id>,
+// timestamp=<time>, or *.
+func (s HistorySelector) String() string {
+	if s.MsgID != "" {
+		return "msgid=" + s.MsgID
+	}
+	if !s.Time.IsZero() {
+		return "timestamp=" + FormatServerTime(s.Time)
+	}
+	return "*"
+}
+
+// ParseHistorySelector parses a CHATHISTORY selector parameter.
+func ParseHistorySelector(s string) (HistorySelector, error) {
+	if s == "*" {
+		return HistorySelector{}, nil
+	}
+
+	if strings.HasPrefix(s, "msgid=") && len(s) > len("msgid=") {
+		return MsgIDSelector(s[len("msgid="):]), nil
+	}
+
+	if strings.HasPrefix(s, "timestamp=") {
+		t, err := ParseServerTime(s[len("timestamp="):])
+		if err != nil {
+			return HistorySelector{}, fmt.Errorf("invalid timestamp: %s", s)
+		}
+		return TimeSelector(t), nil
+	}
+
+	return HistorySelector{}, fmt.Errorf("invalid selector: %s", s)
+}
+
+// HistoryQuery is a CHATHISTORY command.
+type HistoryQuery struct {
+	// Subcommand is one of HistoryLatest, HistoryBefore, etc.
+	Subcommand string
+
+	// Target is the channel or nick. TARGETS has no target.
+	Target string
+
+	// Start is the selector. For BETWEEN and TARGETS it is the first of the
+	// two.
+	Start HistorySelector
+
+	// End is the second selector for BETWEEN and TARGETS.
+	End HistorySelector
+
+	// Limit is the maximum number of messages (or targets) to return.
+	Limit int
+}
+
+// LatestQuery requests the latest messages, optionally only those after
+// since. Use the zero HistorySelector for no such restriction.
+func LatestQuery(target string, since HistorySelector, limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryLatest, Target: target, Start: since,
+		Limit: limit}
+}
+
+// BeforeQuery requests messages before the selector.
+func BeforeQuery(target string, s HistorySelector, limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryBefore, Target: target, Start: s,
+		Limit: limit}
+}
+
+// AfterQuery requests messages after the selector.
+func AfterQuery(target string, s HistorySelector, limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryAfter, Target: target, Start: s,
+		Limit: limit}
+}
+
+// AroundQuery requests messages around the selector.
+func AroundQuery(target string, s HistorySelector, limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryAround, Target: target, Start: s,
+		Limit: limit}
+}
+
+// BetweenQuery requests messages between the two selectors.
+func BetweenQuery(target string, start, end HistorySelector,
+	limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryBetween, Target: target,
+		Start: start, End: end, Limit: limit}
+}
+
+// TargetsQuery requests the conversations with messages between the two
+// times.
+func TargetsQuery(start, end time.Time, limit int) HistoryQuery {
+	return HistoryQuery{Subcommand: HistoryTargets, Start: TimeSelector(start),
+		End: TimeSelector(end), Limit: limit}
+}
+
+// Message creates the CHATHISTORY command.
+//
+// maxLimit is the server's limit from the CHATHISTORY ISUPPORT token. See
+// ParseHistoryLimit. We lower the query's limit to it. If the query has no
+// limit we use it. Zero means the server has no limit.
+func (q HistoryQuery) Message(maxLimit int) (Message, error) {
+	limit := q.Limit
+	if maxLimit > 0 && (limit <= 0 || limit > maxLimit) {
+		limit = maxLimit
+	}
+	if limit <= 0 {
+		return Message{}, fmt.Errorf("a limit is required")
+	}
+
+	params := []string{q.Subcommand}
+
+	switch q.Subcommand {
+	case HistoryLatest:
+		if q.Target == "" {
+			return Message{}, fmt.Errorf("a target is required")
+		}
+		params = append(params, q.Target, q.Start.String())
+	case HistoryBefore, HistoryAfter, HistoryAround:
+		if q.Target == "" || q.Start.IsZero() {
+			return Message{}, fmt.Errorf("a target and selector are required")
+		}
+		params = append(params, q.Target, q.Start.String())
+	case HistoryBetween:
+		if q.Target == "" || q.Start.IsZero() || q.End.IsZero() {
+			return Message{}, fmt.Errorf("a target and two selectors are required")
+		}
+		params = append(params, q.Target, q.Start.String(), q.End.String())
+	case HistoryTargets:
+		if q.Start.Time.IsZero() || q.End.Time.IsZero() {
+			return Message{}, fmt.Errorf("TARGETS requires two timestamps")
+		}
+		params = append(params, q.Start.String(), q.End.String())
+	default:
+		return Message{}, fmt.Errorf("unknown subcommand: %s", q.Subcommand)
+	}
+
+	params = append(params, strconv.Itoa(limit))
+	return Message{Command: "CHATHISTORY", Params: params}, nil
+}
+
+// ParseHistoryLimit parses the value of the CHATHISTORY ISUPPORT token. It is
+// the maximum number of messages a query may request. Zero means there is no
+// limit.
+func ParseHistoryLimit(value string) (int, error) {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid CHATHISTORY limit: %s", value)
+	}
+	return limit, nil
+}
+
+// HistoryMessages returns the messages in a chathistory batch in order.
+//
+// Messages in nested batches, such as multiline batches, appear in place.
+// They keep their batch tag so they can be told apart.
+func HistoryMessages(b *Batch) ([]Message, error) {
+	if b.Type != BatchChatHistory {
+		return nil, fmt.Errorf("not a chathistory batch: %s", b.Type)
+	}
+	return batchMessages(b), nil
+}
+
+func batchMessages(b *Batch) []Message {
+	var msgs []Message
+	for _, m := range b.Messages {
+		if child := b.Child(m); child != nil {
+			msgs = append(msgs, batchMessages(child)...)
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+// HistoryTarget is a conversation from a CHATHISTORY TARGETS reply.
+type HistoryTarget struct {
+	Target string
+
+	// Latest is the time of the latest message.
+	Latest time.Time
+}
+
+// HistoryTargetList parses the reply to CHATHISTORY TARGETS.
+//
+// CHATHISTORY TARGETS <target> <latest timestamp>
+func HistoryTargetList(b *Batch) ([]HistoryTarget, error) {
+	if b.Type != BatchChatHistoryTargets {
+		return nil, fmt.Errorf("not a chathistory targets batch: %s", b.Type)
+	}
+
+	var targets []HistoryTarget
+	for _, m := range b.Messages {
+		if m.Command != "CHATHISTORY" || len(m.Params) != 3 ||
+			m.Params[0] != HistoryTargets {
+			return nil, fmt.Errorf("unexpected message in batch: %s", m)
+		}
+
+		t, err := ParseServerTime(m.Params[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %s", m)
+		}
+
+		targets = append(targets, HistoryTarget{Target: m.Params[1], Latest: t})
+	}
+	return targets, nil
+}
+
+// HistoryFailure returns the reply as an error if the message is a FAIL
+// CHATHISTORY. Otherwise it returns nil.
+//
+// The error is a *StandardReply. Match codes with errors.Is, for example:
+//
+//	errors.Is(err, &StandardReply{Code: "INVALID_TARGET"})
+func HistoryFailure(m Message) error {
+	if m.Command != ReplyTypeFail || len(m.Params) == 0 ||
+		m.Params[0] != "CHATHISTORY" {
+		return nil
+	}
+	return FailError(m)
+}
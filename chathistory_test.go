@@ -0,0 +1,203 @@
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryQueryMessage(t *testing.T) {
+	ts := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts2 := ts.Add(time.Hour)
+
+	tests := []struct {
+		query    HistoryQuery
+		maxLimit int
+		output   string
+		success  bool
+	}{
+		{LatestQuery("#test", HistorySelector{}, 50), 0,
+			"CHATHISTORY LATEST #test * 50\r\n", true},
+		{LatestQuery("#test", MsgIDSelector("abc"), 50), 0,
+			"CHATHISTORY LATEST #test msgid=abc 50\r\n", true},
+		// The server's limit wins.
+		{BeforeQuery("#test", TimeSelector(ts), 500), 100,
+			"CHATHISTORY BEFORE #test timestamp=2019-01-02T03:04:05.000Z 100\r\n",
+			true},
+		// No limit means the server's limit.
+		{AfterQuery("alice", MsgIDSelector("abc"), 0), 100,
+			"CHATHISTORY AFTER alice msgid=abc 100\r\n", true},
+		{AroundQuery("#test", MsgIDSelector("abc"), 10), 100,
+			"CHATHISTORY AROUND #test msgid=abc 10\r\n", true},
+		{BetweenQuery("#test", MsgIDSelector("a"), TimeSelector(ts), 10), 0,
+			"CHATHISTORY BETWEEN #test msgid=a timestamp=2019-01-02T03:04:05.000Z 10\r\n",
+			true},
+		{TargetsQuery(ts, ts2, 10), 0,
+			"CHATHISTORY TARGETS timestamp=2019-01-02T03:04:05.000Z timestamp=2019-01-02T04:04:05.000Z 10\r\n",
+			true},
+		{AfterQuery("alice", MsgIDSelector("abc"), 0), 0, "", false},
+		{BeforeQuery("#test", HistorySelector{}, 10), 0, "", false},
+		{BetweenQuery("#test", MsgIDSelector("a"), HistorySelector{}, 10), 0, "",
+			false},
+		{HistoryQuery{Subcommand: HistoryTargets, Start: MsgIDSelector("a"),
+			End: MsgIDSelector("b"), Limit: 10}, 0, "", false},
+		{HistoryQuery{Subcommand: "SOON", Target: "#test", Limit: 10}, 0, "",
+			false},
+	}
+
+	for _, test := range tests {
+		m, err := test.query.Message(test.maxLimit)
+		if err != nil {
+			if test.success {
+				t.Errorf("Message(%d) for %+v = %s", test.maxLimit, test.query, err)
+			}
+			continue
+		}
+		if !test.success {
+			t.Errorf("Message(%d) for %+v succeeded, wanted error", test.maxLimit,
+				test.query)
+			continue
+		}
+
+		buf, err := m.Encode()
+		if err != nil {
+			t.Fatalf("Encode(%s) = %s", m, err)
+		}
+		if buf != test.output {
+			t.Errorf("Message(%d) for %+v = %q, wanted %q", test.maxLimit,
+				test.query, buf, test.output)
+		}
+	}
+}
+
+func TestParseHistorySelector(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    HistorySelector
+		success bool
+	}{
+		{"*", HistorySelector{}, true},
+		{"msgid=abc", MsgIDSelector("abc"), true},
+		{"timestamp=2019-01-02T03:04:05.000Z",
+			TimeSelector(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)), true},
+		{"msgid=", HistorySelector{}, false},
+		{"timestamp=now", HistorySelector{}, false},
+		{"abc", HistorySelector{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseHistorySelector(test.input)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseHistorySelector(%q) = %s", test.input, err)
+			}
+			continue
+		}
+		if !test.success {
+			t.Errorf("ParseHistorySelector(%q) succeeded, wanted error", test.input)
+			continue
+		}
+		if got.MsgID != test.want.MsgID || !got.Time.Equal(test.want.Time) {
+			t.Errorf("ParseHistorySelector(%q) = %+v, wanted %+v", test.input, got,
+				test.want)
+		}
+	}
+}
+
+// trackBatch feeds lines to a BatchTracker and returns the batch they form.
+func trackBatch(t *testing.T, lines []string) *Batch {
+	tracker := NewBatchTracker()
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		b, _, err := tracker.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+		if b != nil {
+			return b
+		}
+	}
+
+	t.Fatalf("batch did not complete")
+	return nil
+}
+
+func TestHistoryMessages(t *testing.T) {
+	b := trackBatch(t, []string{
+		":irc BATCH +h chathistory #test\r\n",
+		"@batch=h;msgid=1 :alice!a@h PRIVMSG #test :one\r\n",
+		"@batch=h :irc BATCH +m draft/multiline #test\r\n",
+		"@batch=m :bob!b@h PRIVMSG #test :two\r\n",
+		"@batch=m :bob!b@h PRIVMSG #test :three\r\n",
+		":irc BATCH -m\r\n",
+		"@batch=h;msgid=4 :alice!a@h PRIVMSG #test :four\r\n",
+		":irc BATCH -h\r\n",
+	})
+
+	msgs, err := HistoryMessages(b)
+	if err != nil {
+		t.Fatalf("HistoryMessages() = %s", err)
+	}
+
+	var texts []string
+	for _, m := range msgs {
+		texts = append(texts, m.Params[1])
+	}
+	if want := []string{"one", "two", "three", "four"}; !reflect.DeepEqual(texts,
+		want) {
+		t.Errorf("HistoryMessages() gave %q, wanted %q", texts, want)
+	}
+}
+
+func TestHistoryTargetList(t *testing.T) {
+	b := trackBatch(t, []string{
+		":irc BATCH +t draft/chathistory-targets\r\n",
+		"@batch=t :irc CHATHISTORY TARGETS #test 2019-01-02T03:04:05.000Z\r\n",
+		"@batch=t :irc CHATHISTORY TARGETS alice 2019-01-01T00:00:00.000Z\r\n",
+		":irc BATCH -t\r\n",
+	})
+
+	targets, err := HistoryTargetList(b)
+	if err != nil {
+		t.Fatalf("HistoryTargetList() = %s", err)
+	}
+
+	want := []HistoryTarget{
+		{"#test", time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"alice", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("HistoryTargetList() = %+v, wanted %+v", targets, want)
+	}
+}
+
+func TestHistoryFailure(t *testing.T) {
+	m, err := ParseMessage(
+		"FAIL CHATHISTORY INVALID_TARGET LATEST #nope :Messages could not be retrieved\r\n")
+	if err != nil {
+		t.Fatalf("ParseMessage() = %s", err)
+	}
+
+	err = HistoryFailure(m)
+
+	var reply *StandardReply
+	if !errors.As(err, &reply) {
+		t.Fatalf("HistoryFailure() = %v, wanted a StandardReply", err)
+	}
+	if !reflect.DeepEqual(reply.Context, []string{"LATEST", "#nope"}) {
+		t.Errorf("HistoryFailure() = %+v", reply)
+	}
+	if !errors.Is(err, &StandardReply{Code: "INVALID_TARGET"}) {
+		t.Errorf("HistoryFailure() = %s, wanted INVALID_TARGET", err)
+	}
+
+	if err := HistoryFailure(Message{Command: "FAIL",
+		Params: []string{"JOIN", "X", "no"}}); err != nil {
+		t.Errorf("HistoryFailure() for FAIL JOIN = %s, wanted nil", err)
+	}
+}
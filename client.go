@@ -0,0 +1,436 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed is the error Err returns after Close.
+var ErrClientClosed = errors.New("client closed")
+
+// ClientConfig configures a Client.
+type ClientConfig struct {
+	// Nick is the nick to register with.
+	Nick string
+
+	// AltNicks are nicks to try if the server rejects Nick.
+	AltNicks []string
+
+	// NickGenerator makes nicks to try once we run out of AltNicks. If it is
+	// nil registration fails when we run out.
+	NickGenerator NickGenerator
+
+	// RegainNick is how often to try to get Nick back if we registered with
+	// another nick. If the server supports MONITOR we use it instead. Zero
+	// means we don't try.
+	RegainNick time.Duration
+
+	// User is the username. If it is blank we use Nick.
+	User string
+
+	// RealName is the real name. If it is blank we use Nick.
+	RealName string
+
+	// Password is the server password. If it is blank we don't send PASS.
+	Password string
+
+	// Caps are capabilities to request if the server offers them. If there
+	// are any we negotiate capabilities during registration.
+	Caps []string
+
+	// WriteTimeout is how long a write may take. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// Flood limits how fast we send. If it is nil we send without limit.
+	Flood *FloodConfig
+}
+
+// Client is a connection to an IRC server.
+//
+// Create it with NewClient, call Register, then read messages from Incoming
+// and send messages with Send. Send is safe to call from many goroutines.
+//
+// We answer PING for you.
+type Client struct {
+	conn   net.Conn
+	config ClientConfig
+	caps   *CapNegotiator
+	flood  *FloodWriter
+
+	incoming chan Message
+	closed   chan struct{}
+
+	// done is closed by Close.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nick     string
+	err      error
+	regainer *NickRegainer
+}
+
+// NewClient creates a Client using the connection. It starts reading from the
+// connection right away.
+func NewClient(conn net.Conn, config ClientConfig) *Client {
+	if config.User == "" {
+		config.User = config.Nick
+	}
+	if config.RealName == "" {
+		config.RealName = config.Nick
+	}
+
+	c := &Client{
+		conn:     conn,
+		config:   config,
+		incoming: make(chan Message, 64),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+		nick:     config.Nick,
+	}
+	if len(config.Caps) > 0 {
+		c.caps = NewCapNegotiator(config.Caps)
+	}
+	if config.Flood != nil {
+		c.flood = NewFloodWriter(clientWriter{c: c}, *config.Flood)
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+// Incoming returns the channel of messages from the server. It is closed
+// when the connection closes. Err then tells why.
+//
+// Read from it continuously. If it fills up we stop reading from the server,
+// which means we stop answering PINGs as well.
+//
+// Don't read from it until Register returns. Register reads the messages
+// that arrive during registration.
+func (c *Client) Incoming() <-chan Message {
+	return c.incoming
+}
+
+// Err returns the reason the connection closed. It is nil while the
+// connection is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Nick returns our current nick.
+func (c *Client) Nick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// Caps returns the capability negotiator. It is nil if the config did not
+// request any capabilities.
+func (c *Client) Caps() *CapNegotiator {
+	return c.caps
+}
+
+// Flood returns the writer that limits how fast we send. It is nil if the
+// config did not set Flood.
+func (c *Client) Flood() *FloodWriter {
+	return c.flood
+}
+
+// Flush waits until messages queued by Send are written. It only matters if
+// we limit how fast we send. Otherwise Send writes right away.
+func (c *Client) Flush(ctx context.Context) error {
+	if c.flood == nil {
+		return nil
+	}
+	return c.flood.Flush(ctx)
+}
+
+// Close closes the connection.
+//
+// If we limit how fast we send, Close drops messages still queued. To make
+// sure a QUIT goes out, call Flush with a timeout before Close.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	err := c.conn.Close()
+	if c.flood != nil {
+		_ = c.flood.Close()
+	}
+	return err
+}
+
+// Send sends a message. If we limit how fast we send, it queues the message
+// and returns without waiting for it to be written.
+func (c *Client) Send(m Message) error {
+	if c.flood != nil {
+		return c.flood.Send(m)
+	}
+
+	buf, err := m.Encode()
+	if err != nil {
+		return fmt.Errorf("error encoding message: %s", err)
+	}
+
+	return c.write(buf)
+}
+
+func (c *Client) write(buf string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.config.WriteTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(
+			time.Now().Add(c.config.WriteTimeout)); err != nil {
+			return fmt.Errorf("error setting write deadline: %s", err)
+		}
+	}
+
+	if _, err := c.conn.Write([]byte(buf)); err != nil {
+		return fmt.Errorf("error writing: %s", err)
+	}
+	return nil
+}
+
+// Register registers the connection. It sends PASS, NICK, and USER and
+// waits for the server to welcome us. If capabilities are configured we
+// negotiate them first.
+//
+// If the server rejects the nick we try AltNicks and then ones NickGenerator
+// makes. If we run out, or the server rejects us for another reason, we
+// return a *NumericError.
+func (c *Client) Register(ctx context.Context) error {
+	var msgs []Message
+	if c.caps != nil {
+		msgs = append(msgs, c.caps.Start())
+	}
+	if c.config.Password != "" {
+		msgs = append(msgs, Message{Command: "PASS",
+			Params: []string{c.config.Password}})
+	}
+	msgs = append(msgs,
+		Message{Command: "NICK", Params: []string{c.config.Nick}},
+		Message{Command: "USER",
+			Params: []string{c.config.User, "0", "*", c.config.RealName}},
+	)
+
+	if err := c.sendAll(msgs); err != nil {
+		return err
+	}
+
+	fallback := &NickFallback{
+		Preferred:  c.config.Nick,
+		Alternates: c.config.AltNicks,
+		Generator:  c.config.NickGenerator,
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-c.incoming:
+			if !ok {
+				if err := c.Err(); err != nil {
+					return fmt.Errorf("connection closed during registration: %s",
+						err)
+				}
+				return fmt.Errorf("connection closed during registration")
+			}
+
+			done, err := c.registrationMessage(m, fallback)
+			if err != nil || done {
+				return err
+			}
+		}
+	}
+}
+
+// registrationMessage handles a message during registration. It returns true
+// once we are registered.
+func (c *Client) registrationMessage(m Message,
+	fallback *NickFallback) (bool, error) {
+	if c.caps != nil {
+		replies, err := c.caps.Handle(m)
+		if err != nil {
+			return false, err
+		}
+		if err := c.sendAll(replies); err != nil {
+			return false, err
+		}
+	}
+
+	switch m.Command {
+	case ReplyWelcome:
+		if len(m.Params) > 0 {
+			c.mu.Lock()
+			c.nick = m.Params[0]
+			c.mu.Unlock()
+		}
+		return true, nil
+	case ErrorErroneusNickname, ErrorNicknameInUse, ErrorNickCollision,
+		ErrorUnavailResource:
+		nick, ok := fallback.Next()
+		if !ok {
+			return false, NewNumericError(m)
+		}
+		c.mu.Lock()
+		c.nick = nick
+		c.mu.Unlock()
+		return false, c.Send(Message{Command: "NICK", Params: []string{nick}})
+	case ErrorNoNicknameGiven, ErrorPasswdMismatch, ErrorYoureBannedCreep:
+		return false, NewNumericError(m)
+	case "ERROR":
+		return false, fmt.Errorf("server sent ERROR: %s",
+			strings.Join(m.Params, " "))
+	}
+
+	return false, nil
+}
+
+func (c *Client) sendAll(msgs []Message) error {
+	for _, m := range msgs {
+		if err := c.Send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLoop reads messages from the server until the connection closes.
+func (c *Client) readLoop() {
+	defer close(c.incoming)
+	defer close(c.closed)
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			select {
+			case <-c.done:
+				c.setErr(ErrClientClosed)
+			default:
+				c.setErr(err)
+			}
+			return
+		}
+
+		m, err := ParseMessage(line)
+		if err != nil && err != ErrTruncated {
+			// Skip lines we can't parse.
+			continue
+		}
+
+		switch m.Command {
+		case "PING":
+			pong := Message{Command: "PONG", Params: m.Params}
+			if err := c.Send(pong); err != nil {
+				c.setErr(err)
+				_ = c.conn.Close()
+				return
+			}
+		case "NICK":
+			c.mu.Lock()
+			if len(m.Params) > 0 && foldName(m.SourceNick()) == foldName(c.nick) {
+				c.nick = m.Params[0]
+			}
+			c.mu.Unlock()
+		case ReplyWelcome:
+			c.startRegain(m)
+		}
+
+		if err := c.sendAll(c.regain(m)); err != nil {
+			c.setErr(err)
+			_ = c.conn.Close()
+			return
+		}
+
+		select {
+		case c.incoming <- m:
+		case <-c.done:
+			c.setErr(ErrClientClosed)
+			return
+		}
+	}
+}
+
+// startRegain starts trying to get our nick back if we registered with
+// another.
+func (c *Client) startRegain(welcome Message) {
+	if c.config.RegainNick <= 0 || len(welcome.Params) == 0 ||
+		foldName(welcome.Params[0]) == foldName(c.config.Nick) {
+		return
+	}
+
+	c.mu.Lock()
+	c.regainer = NewNickRegainer(c.config.Nick, welcome.Params[0])
+	c.mu.Unlock()
+
+	go c.regainLoop()
+}
+
+// regain passes a message to the NickRegainer, if there is one, and returns
+// what it wants to send.
+func (c *Client) regain(m Message) []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.regainer == nil {
+		return nil
+	}
+	return c.regainer.Handle(m)
+}
+
+// regainLoop periodically asks for our nick until we have it or the
+// connection closes.
+func (c *Client) regainLoop() {
+	ticker := time.NewTicker(c.config.RegainNick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		msgs := c.regainer.Tick()
+		regained := c.regainer.Regained()
+		c.mu.Unlock()
+
+		if regained {
+			return
+		}
+		if err := c.sendAll(msgs); err != nil {
+			return
+		}
+	}
+}
+
+// clientWriter lets a FloodWriter write to the client's connection.
+type clientWriter struct {
+	c *Client
+}
+
+func (w clientWriter) Write(p []byte) (int, error) {
+	if err := w.c.write(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Client) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
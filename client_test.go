@@ -0,0 +1,341 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is the server end of a net.Pipe.
+type fakeServer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, net.Conn) {
+	server, client := net.Pipe()
+	return &fakeServer{t: t, conn: server, reader: bufio.NewReader(server)}, client
+}
+
+// expect reads a line from the client and checks it.
+func (s *fakeServer) expect(want string) {
+	if err := s.conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		s.t.Errorf("SetReadDeadline() = %s", err)
+		return
+	}
+
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		s.t.Errorf("reading from client: %s (wanted %q)", err, want)
+		return
+	}
+	if line != want {
+		s.t.Errorf("client sent %q, wanted %q", line, want)
+	}
+}
+
+func (s *fakeServer) send(line string) {
+	if _, err := s.conn.Write([]byte(line)); err != nil {
+		s.t.Errorf("writing to client: %s", err)
+	}
+}
+
+func TestClientRegister(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice", Password: "pw",
+		RealName: "Alice A"})
+	defer func() { _ = c.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.expect("PASS pw\r\n")
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * :Alice A\r\n")
+		server.send(":irc NOTICE * :*** Looking up your hostname\r\n")
+		server.send("PING :abc\r\n")
+		server.expect("PONG abc\r\n")
+		server.send(":irc 001 alice :Welcome\r\n")
+		server.send(":irc 005 alice CHATHISTORY=100 :are supported\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); err != nil {
+		t.Fatalf("Register() = %s", err)
+	}
+
+	select {
+	case m := <-c.Incoming():
+		if m.Command != "005" {
+			t.Errorf("got %s, wanted 005", m)
+		}
+	case <-ctx.Done():
+		t.Fatalf("no message after registration")
+	}
+
+	wg.Wait()
+}
+
+func TestClientRegisterNickInUse(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice"})
+	defer func() { _ = c.Close() }()
+
+	go func() {
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * alice\r\n")
+		server.send(":irc 433 * alice :Nickname is already in use\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); !errors.Is(err, ErrNickInUse) {
+		t.Fatalf("Register() = %v, wanted ErrNickInUse", err)
+	}
+}
+
+func TestClientRegisterNickFallback(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice", AltNicks: []string{"bob"},
+		NickGenerator: NickUnderscore})
+	defer func() { _ = c.Close() }()
+
+	go func() {
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * alice\r\n")
+		server.send(":irc 433 * alice :Nickname is already in use\r\n")
+		server.expect("NICK bob\r\n")
+		server.send(":irc 437 * bob :Nick/channel is temporarily unavailable\r\n")
+		server.expect("NICK alice_\r\n")
+		server.send(":irc 001 alice_ :Welcome\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); err != nil {
+		t.Fatalf("Register() = %s", err)
+	}
+
+	if c.Nick() != "alice_" {
+		t.Errorf("Nick() = %s, wanted alice_", c.Nick())
+	}
+}
+
+func TestClientRegainNick(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice",
+		NickGenerator: NickNumeric, RegainNick: time.Hour})
+	defer func() { _ = c.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * alice\r\n")
+		server.send(":irc 433 * alice :Nickname is already in use\r\n")
+		server.expect("NICK alice1\r\n")
+		server.send(":irc 001 alice1 :Welcome\r\n")
+		server.send(":irc 005 alice1 MONITOR=100 :are supported\r\n")
+		server.expect("MONITOR + alice\r\n")
+		server.send(":irc 731 alice1 :alice\r\n")
+		server.expect("NICK alice\r\n")
+		server.send(":alice1!u@h NICK alice\r\n")
+		server.expect("MONITOR - alice\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); err != nil {
+		t.Fatalf("Register() = %s", err)
+	}
+
+	for m := range c.Incoming() {
+		if m.Command == "NICK" {
+			break
+		}
+	}
+
+	if c.Nick() != "alice" {
+		t.Errorf("Nick() = %s, wanted alice", c.Nick())
+	}
+
+	wg.Wait()
+}
+
+func TestClientRegisterCaps(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice",
+		Caps: []string{"server-time"}})
+	defer func() { _ = c.Close() }()
+
+	go func() {
+		server.expect("CAP LS 302\r\n")
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * alice\r\n")
+		server.send(":irc CAP * LS :multi-prefix server-time\r\n")
+		server.expect("CAP REQ server-time\r\n")
+		server.send(":irc CAP * ACK server-time\r\n")
+		server.expect("CAP END\r\n")
+		server.send(":irc 001 alice :Welcome\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); err != nil {
+		t.Fatalf("Register() = %s", err)
+	}
+
+	if !c.Caps().Enabled("server-time") {
+		t.Errorf("server-time is not enabled")
+	}
+}
+
+func TestClientFlood(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice",
+		Flood: &DefaultFloodConfig})
+	defer func() { _ = c.Close() }()
+
+	if c.Flood() == nil {
+		t.Fatalf("Flood() = nil, wanted a FloodWriter")
+	}
+
+	go func() {
+		server.expect("NICK alice\r\n")
+		server.expect("USER alice 0 * alice\r\n")
+		server.send("PING :abc\r\n")
+		server.expect("PONG abc\r\n")
+		server.send(":irc 001 alice :Welcome\r\n")
+		server.expect("QUIT bye\r\n")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Register(ctx); err != nil {
+		t.Fatalf("Register() = %s", err)
+	}
+
+	if err := c.Send(Message{Command: "QUIT", Params: []string{"bye"}}); err != nil {
+		t.Fatalf("Send() = %s", err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush() = %s", err)
+	}
+}
+
+func TestClientSendConcurrent(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice"})
+	defer func() { _ = c.Close() }()
+
+	const senders = 10
+	const each = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if err := c.Send(Message{Command: "PRIVMSG",
+					Params: []string{"#test", strings.Repeat("x", 100)}}); err != nil {
+					t.Errorf("Send() = %s", err)
+				}
+			}
+		}()
+	}
+
+	// Every line arrives intact.
+	for i := 0; i < senders*each; i++ {
+		server.expect("PRIVMSG #test " + strings.Repeat("x", 100) + "\r\n")
+	}
+
+	wg.Wait()
+}
+
+func TestClientClosed(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice"})
+
+	go func() {
+		server.send(":alice!a@h NICK alice2\r\n")
+		_ = server.conn.Close()
+	}()
+
+	m, ok := <-c.Incoming()
+	if !ok || m.Command != "NICK" {
+		t.Fatalf("got %v, %v, wanted NICK", m, ok)
+	}
+	if c.Nick() != "alice2" {
+		t.Errorf("Nick() = %s, wanted alice2", c.Nick())
+	}
+
+	if _, ok := <-c.Incoming(); ok {
+		t.Fatalf("Incoming() is still open")
+	}
+	if c.Err() == nil {
+		t.Errorf("Err() = nil after the connection closed")
+	}
+}
+
+func TestClientCloseWhileBlocked(t *testing.T) {
+	server, conn := newFakeServer(t)
+
+	c := NewClient(conn, ClientConfig{Nick: "alice"})
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := server.conn.Write(
+				[]byte(":irc NOTICE alice :hi\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Wait for Incoming to fill up so that the read loop is stuck.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.incoming) < cap(c.incoming) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Incoming() never filled up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	// Don't read from Incoming. The read loop must stop anyway.
+	select {
+	case <-c.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("read loop still running after Close()")
+	}
+
+	if err := c.Err(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Err() = %v, wanted %s", err, ErrClientClosed)
+	}
+}
@@ -0,0 +1,293 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplySpec describes the numerics a server answers a command with. Many
+// commands follow the same pattern: an optional start numeric, zero or more
+// item numerics, then an end numeric. Or an error numeric instead.
+type ReplySpec struct {
+	// Name describes the reply, such as "MOTD".
+	Name string
+
+	Start  []string
+	Items  []string
+	End    []string
+	Errors []string
+
+	// ItemTargetParam is the index of the parameter that holds the query's
+	// target (such as the channel) in item replies. Messages with a different
+	// target are not part of the reply. Zero means item replies do not have a
+	// target (parameter 0 is always the client).
+	ItemTargetParam int
+
+	// EndTargetParam is like ItemTargetParam but for end replies.
+	EndTargetParam int
+
+	// ErrorTargetParam is like ItemTargetParam but for error replies.
+	ErrorTargetParam int
+}
+
+// Response holds the messages making up a complete reply.
+type Response struct {
+	Start []Message
+	Items []Message
+	End   Message
+}
+
+// Collector gathers the messages making up the reply to a command according
+// to a ReplySpec.
+//
+// Unrelated messages are ignored, so it is fine to feed it all incoming
+// messages. A Collector gathers a single reply. Create a new one for each
+// command.
+type Collector struct {
+	spec   ReplySpec
+	target string
+	resp   *Response
+	done   bool
+}
+
+// NewCollector creates a Collector.
+//
+// target is the target of the command, such as the channel for a ban list.
+// It is only used if the spec has target parameters.
+func NewCollector(spec ReplySpec, target string) *Collector {
+	return &Collector{
+		spec:   spec,
+		target: target,
+		resp:   &Response{},
+	}
+}
+
+// Add processes a message.
+//
+// When the message completes the reply we return it and true. Other messages
+// give false.
+//
+// If the message is one of the error numerics, we return a *NumericError and
+// true.
+func (c *Collector) Add(m Message) (*Response, bool, error) {
+	if c.done {
+		return nil, false, nil
+	}
+
+	switch {
+	case contains(c.spec.Errors, m.Command):
+		if !c.targetMatches(m, c.spec.ErrorTargetParam) {
+			return nil, false, nil
+		}
+		c.done = true
+		return nil, true, NewNumericError(m)
+	case contains(c.spec.Start, m.Command):
+		c.resp.Start = append(c.resp.Start, m)
+	case contains(c.spec.Items, m.Command):
+		if !c.targetMatches(m, c.spec.ItemTargetParam) {
+			return nil, false, nil
+		}
+		c.resp.Items = append(c.resp.Items, m)
+	case contains(c.spec.End, m.Command):
+		if !c.targetMatches(m, c.spec.EndTargetParam) {
+			return nil, false, nil
+		}
+		c.done = true
+		c.resp.End = m
+		return c.resp, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// targetMatches checks whether the message is about the collector's target.
+func (c *Collector) targetMatches(m Message, param int) bool {
+	if param == 0 {
+		return true
+	}
+	if len(m.Params) <= param {
+		return false
+	}
+	return foldName(m.Params[param]) == foldName(c.target)
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// These are specs for common replies.
+var (
+	// MOTDReplies is the reply to MOTD. We also receive it after registering.
+	MOTDReplies = ReplySpec{
+		Name:   "MOTD",
+		Start:  []string{ReplyMOTDStart},
+		Items:  []string{ReplyMOTD},
+		End:    []string{ReplyEndOfMOTD},
+		Errors: []string{ErrorNoMOTD},
+	}
+
+	// ListReplies is the reply to LIST.
+	ListReplies = ReplySpec{
+		Name:  "LIST",
+		Start: []string{ReplyListStart},
+		Items: []string{ReplyList},
+		End:   []string{ReplyListEnd},
+	}
+
+	// BanListReplies is the reply to MODE <channel> +b. The target is the
+	// channel.
+	BanListReplies = ReplySpec{
+		Name:             "ban list",
+		Items:            []string{ReplyBanList},
+		End:              []string{ReplyEndOfBanList},
+		Errors:           []string{ErrorNoSuchChannel, ErrorChanOPrivsNeeded},
+		ItemTargetParam:  1,
+		EndTargetParam:   1,
+		ErrorTargetParam: 1,
+	}
+
+	// ExceptListReplies is the reply to MODE <channel> +e. The target is the
+	// channel.
+	ExceptListReplies = ReplySpec{
+		Name:             "exception list",
+		Items:            []string{ReplyExceptList},
+		End:              []string{ReplyEndOfExceptList},
+		Errors:           []string{ErrorNoSuchChannel, ErrorChanOPrivsNeeded},
+		ItemTargetParam:  1,
+		EndTargetParam:   1,
+		ErrorTargetParam: 1,
+	}
+
+	// InviteListReplies is the reply to MODE <channel> +I. The target is the
+	// channel.
+	InviteListReplies = ReplySpec{
+		Name:             "invite list",
+		Items:            []string{ReplyInviteList},
+		End:              []string{ReplyEndOfInviteList},
+		Errors:           []string{ErrorNoSuchChannel, ErrorChanOPrivsNeeded},
+		ItemTargetParam:  1,
+		EndTargetParam:   1,
+		ErrorTargetParam: 1,
+	}
+
+	// LinksReplies is the reply to LINKS.
+	LinksReplies = ReplySpec{
+		Name:   "LINKS",
+		Items:  []string{ReplyLinks},
+		End:    []string{ReplyEndOfLinks},
+		Errors: []string{ErrorNoSuchServer},
+	}
+
+	// StatsReplies is the reply to STATS. The target is the query letter.
+	//
+	// The item numerics depend on the query and the server. We include the
+	// common ones.
+	StatsReplies = ReplySpec{
+		Name: "STATS",
+		Items: []string{"211", "212", "213", "214", "215", "216", "217", "218",
+			"240", "241", "242", "243", "244", "245", "246", "247", "248", "249",
+			"250"},
+		End:            []string{ReplyEndOfStats},
+		Errors:         []string{ErrorNoPrivileges, ErrorNoSuchServer},
+		EndTargetParam: 1,
+	}
+
+	// InfoReplies is the reply to INFO.
+	InfoReplies = ReplySpec{
+		Name:   "INFO",
+		Start:  []string{ReplyInfoStart},
+		Items:  []string{ReplyInfo},
+		End:    []string{ReplyEndOfInfo},
+		Errors: []string{ErrorNoSuchServer},
+	}
+)
+
+// Text returns the last parameter of each item. For replies such as MOTD and
+// INFO this is the text of each line.
+//
+// For the MOTD, servers prefix each line with "- ". We leave it in place.
+func (r *Response) Text() []string {
+	var lines []string
+	for _, m := range r.Items {
+		if len(m.Params) == 0 {
+			continue
+		}
+		lines = append(lines, m.Params[len(m.Params)-1])
+	}
+	return lines
+}
+
+// ListEntry is a channel from a LIST reply.
+type ListEntry struct {
+	Channel string
+	Users   int
+	Topic   string
+}
+
+// ListEntries parses the items of a LIST reply.
+//
+// <client> <channel> <client count> :<topic>
+func (r *Response) ListEntries() ([]ListEntry, error) {
+	var entries []ListEntry
+	for _, m := range r.Items {
+		if len(m.Params) != 4 {
+			return nil, fmt.Errorf("malformed RPL_LIST: %s", m)
+		}
+
+		users, err := strconv.Atoi(m.Params[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid user count: %s", m)
+		}
+
+		entries = append(entries, ListEntry{
+			Channel: m.Params[1],
+			Users:   users,
+			Topic:   m.Params[3],
+		})
+	}
+	return entries, nil
+}
+
+// MaskEntry is an entry in a channel's ban, exception, or invite list.
+type MaskEntry struct {
+	Mask string
+
+	// SetBy and SetAt are who set the entry and when. Not all servers send
+	// these.
+	SetBy string
+	SetAt time.Time
+}
+
+// MaskEntries parses the items of a ban, exception, or invite list reply.
+//
+// <client> <channel> <mask> [<who> <set-ts>]
+func (r *Response) MaskEntries() ([]MaskEntry, error) {
+	var entries []MaskEntry
+	for _, m := range r.Items {
+		if len(m.Params) < 3 {
+			return nil, fmt.Errorf("malformed list entry: %s", m)
+		}
+
+		entry := MaskEntry{Mask: m.Params[2]}
+
+		if len(m.Params) >= 5 {
+			entry.SetBy = m.Params[3]
+
+			ts, err := strconv.ParseInt(strings.TrimSpace(m.Params[4]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid set time: %s", m)
+			}
+			entry.SetAt = time.Unix(ts, 0)
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,156 @@
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collect feeds lines to the collector until it finishes.
+func collect(t *testing.T, c *Collector, lines []string) (*Response, error) {
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		resp, done, err := c.Add(m)
+		if done {
+			return resp, err
+		}
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+	}
+
+	t.Fatalf("collector did not finish")
+	return nil, nil
+}
+
+func TestCollectorMOTD(t *testing.T) {
+	resp, err := collect(t, NewCollector(MOTDReplies, ""), []string{
+		":irc 375 me :- irc Message of the day -\r\n",
+		":irc 372 me :- line one\r\n",
+		":irc NOTICE me :unrelated\r\n",
+		":irc 372 me :- line two\r\n",
+		":irc 376 me :End of /MOTD command.\r\n",
+	})
+	if err != nil {
+		t.Fatalf("collecting MOTD failed: %s", err)
+	}
+
+	if len(resp.Start) != 1 {
+		t.Errorf("got %d start messages, wanted 1", len(resp.Start))
+	}
+
+	want := []string{"- line one", "- line two"}
+	if got := resp.Text(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Text() = %q, wanted %q", got, want)
+	}
+
+	if resp.End.Command != ReplyEndOfMOTD {
+		t.Errorf("end is %s, wanted %s", resp.End.Command, ReplyEndOfMOTD)
+	}
+}
+
+func TestCollectorNoMOTD(t *testing.T) {
+	_, err := collect(t, NewCollector(MOTDReplies, ""), []string{
+		":irc 422 me :MOTD File is missing\r\n",
+	})
+
+	var numErr *NumericError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("got error %v, wanted a NumericError", err)
+	}
+	if numErr.Message.Command != ErrorNoMOTD {
+		t.Errorf("got numeric %s, wanted %s", numErr.Message.Command, ErrorNoMOTD)
+	}
+	if err.Error() != "422: MOTD File is missing" {
+		t.Errorf("Error() = %s", err)
+	}
+}
+
+func TestCollectorList(t *testing.T) {
+	resp, err := collect(t, NewCollector(ListReplies, ""), []string{
+		":irc 321 me Channel :Users  Name\r\n",
+		":irc 322 me #test 12 :[+nt] Test channel\r\n",
+		":irc 322 me #empty 0 :\r\n",
+		":irc 323 me :End of /LIST\r\n",
+	})
+	if err != nil {
+		t.Fatalf("collecting LIST failed: %s", err)
+	}
+
+	entries, err := resp.ListEntries()
+	if err != nil {
+		t.Fatalf("ListEntries() = %s", err)
+	}
+
+	want := []ListEntry{
+		{Channel: "#test", Users: 12, Topic: "[+nt] Test channel"},
+		{Channel: "#empty", Users: 0, Topic: ""},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ListEntries() = %+v, wanted %+v", entries, want)
+	}
+}
+
+func TestCollectorBanList(t *testing.T) {
+	// Replies for two channels are interleaved. We only want #test's.
+	resp, err := collect(t, NewCollector(BanListReplies, "#test"), []string{
+		":irc 367 me #test *!*@bad.example.com op!o@h 1500000000\r\n",
+		":irc 367 me #other *!*@other.example.com\r\n",
+		":irc 368 me #other :End of Channel Ban List\r\n",
+		":irc 367 me #TEST *!*@worse.example.com\r\n",
+		":irc 368 me #test :End of Channel Ban List\r\n",
+	})
+	if err != nil {
+		t.Fatalf("collecting ban list failed: %s", err)
+	}
+
+	entries, err := resp.MaskEntries()
+	if err != nil {
+		t.Fatalf("MaskEntries() = %s", err)
+	}
+
+	want := []MaskEntry{
+		{Mask: "*!*@bad.example.com", SetBy: "op!o@h",
+			SetAt: time.Unix(1500000000, 0)},
+		{Mask: "*!*@worse.example.com"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("MaskEntries() = %+v, wanted %+v", entries, want)
+	}
+}
+
+func TestCollectorBanListError(t *testing.T) {
+	_, err := collect(t, NewCollector(BanListReplies, "#nope"), []string{
+		":irc 403 me #other :No such channel\r\n",
+		":irc 403 me #nope :No such channel\r\n",
+	})
+
+	var numErr *NumericError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("got error %v, wanted a NumericError", err)
+	}
+	if numErr.Message.Params[1] != "#nope" {
+		t.Errorf("error is for %s, wanted #nope", numErr.Message.Params[1])
+	}
+}
+
+func TestCollectorStats(t *testing.T) {
+	resp, err := collect(t, NewCollector(StatsReplies, "u"), []string{
+		":irc 219 me o :End of /STATS report\r\n",
+		":irc 242 me :Server Up 1 days 2:03:04\r\n",
+		":irc 219 me u :End of /STATS report\r\n",
+	})
+	if err != nil {
+		t.Fatalf("collecting STATS failed: %s", err)
+	}
+
+	want := []string{"Server Up 1 days 2:03:04"}
+	if got := resp.Text(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Text() = %q, wanted %q", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package irc
+
+import "strings"
+
+// ctcpDelim marks the start and end of a CTCP message.
+const ctcpDelim = "\x01"
+
+// ParseCTCP parses CTCP from the text of a PRIVMSG or NOTICE. It returns the
+// verb, such as ACTION or VERSION, and its arguments. If the text is not CTCP
+// it returns false.
+//
+// We accept a missing trailing delimiter since some clients omit it.
+func ParseCTCP(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, ctcpDelim) {
+		return "", "", false
+	}
+
+	text = strings.TrimSuffix(text[1:], ctcpDelim)
+
+	verb := text
+	args := ""
+	if idx := strings.IndexByte(text, ' '); idx != -1 {
+		verb = text[:idx]
+		args = text[idx+1:]
+	}
+
+	if verb == "" {
+		return "", "", false
+	}
+	return strings.ToUpper(verb), args, true
+}
+
+// CTCP creates the text of a CTCP message.
+func CTCP(verb, args string) string {
+	if args == "" {
+		return ctcpDelim + verb + ctcpDelim
+	}
+	return ctcpDelim + verb + " " + args + ctcpDelim
+}
+
+// IsChannel returns true if the target looks like a channel name.
+func IsChannel(target string) bool {
+	return target != "" && strings.IndexByte(channelTypes, target[0]) != -1
+}
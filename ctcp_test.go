@@ -0,0 +1,67 @@
+package irc
+
+import "testing"
+
+func TestParseCTCP(t *testing.T) {
+	tests := []struct {
+		input string
+		verb  string
+		args  string
+		ok    bool
+	}{
+		{"\x01VERSION\x01", "VERSION", "", true},
+		{"\x01ACTION waves\x01", "ACTION", "waves", true},
+		{"\x01action waves", "ACTION", "waves", true},
+		{"\x01PING 123 456\x01", "PING", "123 456", true},
+		{"hi there", "", "", false},
+		{"\x01\x01", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, test := range tests {
+		verb, args, ok := ParseCTCP(test.input)
+		if verb != test.verb || args != test.args || ok != test.ok {
+			t.Errorf("ParseCTCP(%q) = %q, %q, %v, wanted %q, %q, %v", test.input,
+				verb, args, ok, test.verb, test.args, test.ok)
+		}
+	}
+}
+
+func TestCTCP(t *testing.T) {
+	tests := []struct {
+		verb   string
+		args   string
+		output string
+	}{
+		{"VERSION", "", "\x01VERSION\x01"},
+		{"ACTION", "waves", "\x01ACTION waves\x01"},
+	}
+
+	for _, test := range tests {
+		output := CTCP(test.verb, test.args)
+		if output != test.output {
+			t.Errorf("CTCP(%q, %q) = %q, wanted %q", test.verb, test.args, output,
+				test.output)
+		}
+	}
+}
+
+func TestIsChannel(t *testing.T) {
+	tests := []struct {
+		input  string
+		output bool
+	}{
+		{"#test", true},
+		{"&test", true},
+		{"nick", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		output := IsChannel(test.input)
+		if output != test.output {
+			t.Errorf("IsChannel(%q) = %v, wanted %v", test.input, output,
+				test.output)
+		}
+	}
+}
@@ -17,6 +17,16 @@ func ParseMessage(line string) (Message, error) {
 		return Message{}, fmt.Errorf("line does not have a valid ending: %s", line)
 	}
 
+	// Tags are optional. They have their own length limit, so deal with them
+	// before anything else.
+	var tags map[string]string
+	if line[0] == '@' {
+		tags, line, err = parseTags(line)
+		if err != nil {
+			return Message{}, fmt.Errorf("problem parsing tags: %s", err)
+		}
+	}
+
 	truncated := false
 
 	if len(line) > MaxLineLength {
@@ -25,7 +35,7 @@ func ParseMessage(line string) (Message, error) {
 		line = line[0:MaxLineLength-2] + "\r\n"
 	}
 
-	message := Message{}
+	message := Message{Tags: tags}
 	index := 0
 
 	// It is optional to have a prefix.
@@ -107,6 +117,129 @@ func fixLineEnding(line string) (string, error) {
 	return "", fmt.Errorf("line has no ending CRLF or LF")
 }
 
+// parseTags parses the tags portion of a message.
+//
+// line begins with @. We return the tags and the remainder of the line after
+// the tags and the space following them.
+//
+// message    =  [ "@" tags SPACE ] [ ":" prefix SPACE ] command [ params ] crlf
+// tags       =  tag *[ ";" tag ]
+// tag        =  key [ "=" escaped_value ]
+func parseTags(line string) (map[string]string, string, error) {
+	end := strings.IndexByte(line, ' ')
+	if end == -1 {
+		return nil, "", fmt.Errorf("no space found after tags")
+	}
+
+	// The limit includes the @ and the space.
+	if end+1 > MaxTagsLength {
+		return nil, "", fmt.Errorf("tags are too long")
+	}
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(line[1:end], ";") {
+		// Permit empty tags such as from a trailing ;.
+		if tag == "" {
+			continue
+		}
+
+		key := tag
+		value := ""
+		if idx := strings.IndexByte(tag, '='); idx != -1 {
+			key = tag[:idx]
+			value = unescapeTagValue(tag[idx+1:])
+		}
+
+		if !isValidTagKey(key) {
+			return nil, "", fmt.Errorf("invalid tag key: %q", key)
+		}
+
+		// If a key is repeated, the last value wins.
+		tags[key] = value
+	}
+
+	// There should be a single space. Be lenient and permit several.
+	for end < len(line) && line[end] == ' ' {
+		end++
+	}
+
+	return tags, line[end:], nil
+}
+
+// unescapeTagValue unescapes a tag value.
+//
+// An escape of a character that does not need escaping is that character,
+// and a trailing backslash is dropped.
+func unescapeTagValue(value string) string {
+	if strings.IndexByte(value, '\\') == -1 {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if i == len(value) {
+			break
+		}
+
+		switch value[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+
+	return b.String()
+}
+
+// isValidTagKey checks a tag key is well formed.
+//
+// key        =  [ client_prefix ] [ vendor "/" ] key_name
+// key_name   =  1*( ALPHA / DIGIT / "-" )
+//
+// The vendor is a hostname. We are lenient and do not validate it beyond
+// checking for characters that can't appear in a key.
+func isValidTagKey(key string) bool {
+	key = strings.TrimPrefix(key, "+")
+
+	name := key
+	if idx := strings.LastIndexByte(key, '/'); idx != -1 {
+		vendor := key[:idx]
+		name = key[idx+1:]
+
+		if vendor == "" || strings.ContainsAny(vendor,
+			" ;=\x00\r\n@:!") {
+			return false
+		}
+	}
+
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
 // parsePrefix parses out the prefix portion of a string.
 //
 // line begins with : and ends with \n.
@@ -2,9 +2,28 @@ package irc
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
+// InjectionPolicy controls what encoding does if the message contains CR, LF,
+// or NUL. These bytes can't appear in a message. If we were to include them,
+// then someone who controls part of a message (for example text we echo back)
+// could cause us to send arbitrary extra protocol lines.
+type InjectionPolicy int
+
+const (
+	// InjectionReject makes encoding fail with an error wrapping ErrInjection.
+	InjectionReject InjectionPolicy = iota
+
+	// InjectionStrip removes CR, LF, and NUL from the prefix and parameters.
+	InjectionStrip
+
+	// InjectionReplace replaces each CR, LF, and NUL in the prefix and
+	// parameters with a space.
+	InjectionReplace
+)
+
 // Encode encodes the Message into a raw protocol message string.
 //
 // The resulting string will have a trailing CRLF.
@@ -13,12 +32,40 @@ import (
 // MaxLineLength bytes), we truncate and return as much as we can and return
 // ErrTruncated. This truncated message may still be usable.
 //
-// It does not enforce command specific semantics.
+// If the message contains CR, LF, or NUL we return an error wrapping
+// ErrInjection. See EncodeWithPolicy to handle them differently.
+//
+// We check the message is well formed: The command must be letters or a 3
+// digit numeric, the prefix must not contain a space, and only the last
+// parameter may contain a space, start with ':', or be empty. It does not
+// enforce command specific semantics.
 func (m Message) Encode() (string, error) {
+	return m.EncodeWithPolicy(InjectionReject)
+}
+
+// EncodeWithPolicy is like Encode except CR, LF, and NUL are handled
+// according to the given policy.
+//
+// The command may never contain these bytes, so the policy does not apply to
+// it.
+func (m Message) EncodeWithPolicy(policy InjectionPolicy) (string, error) {
+	if !isValidCommand(m.Command) {
+		return "", fmt.Errorf("invalid command: %q", m.Command)
+	}
+
+	prefix, err := applyInjectionPolicy(m.Prefix, policy)
+	if err != nil {
+		return "", fmt.Errorf("prefix: %w", err)
+	}
+
+	if strings.Contains(prefix, " ") {
+		return "", fmt.Errorf("prefix contains a space")
+	}
+
 	s := ""
 
-	if len(m.Prefix) > 0 {
-		s += ":" + m.Prefix + " "
+	if len(prefix) > 0 {
+		s += ":" + prefix + " "
 	}
 
 	s += m.Command
@@ -35,6 +82,11 @@ func (m Message) Encode() (string, error) {
 	}
 
 	for i, param := range m.Params {
+		param, err := applyInjectionPolicy(param, policy)
+		if err != nil {
+			return "", fmt.Errorf("parameter %d: %w", i, err)
+		}
+
 		// We need to prefix the parameter with a colon in a few cases:
 		//
 		// 1) When there is a space in the parameter
@@ -87,9 +139,117 @@ func (m Message) Encode() (string, error) {
 
 	s += "\r\n"
 
+	if len(m.Tags) > 0 {
+		tags, err := encodeTags(m.Tags)
+		if err != nil {
+			return "", err
+		}
+		s = tags + s
+	}
+
 	if truncated {
 		return s, ErrTruncated
 	}
 
 	return s, nil
 }
+
+// encodeTags encodes the tags portion of a message, including the leading '@'
+// and the trailing space.
+//
+// We encode the tags sorted by key so the result is predictable.
+func encodeTags(tags map[string]string) (string, error) {
+	s := "@"
+
+	for i, key := range sortedTagKeys(tags) {
+		if !isValidTagKey(key) {
+			return "", fmt.Errorf("invalid tag key: %q", key)
+		}
+
+		if i > 0 {
+			s += ";"
+		}
+		s += key
+
+		if value := tags[key]; value != "" {
+			s += "=" + tagValueEscaper.Replace(value)
+		}
+	}
+
+	s += " "
+
+	if len(s) > MaxTagsLength {
+		return "", fmt.Errorf("tags are too long")
+	}
+
+	return s, nil
+}
+
+var tagValueEscaper = strings.NewReplacer(
+	";", "\\:",
+	" ", "\\s",
+	"\\", "\\\\",
+	"\r", "\\r",
+	"\n", "\\n",
+	// NUL can't appear in a message, escaped or not. Drop it.
+	"\x00", "",
+)
+
+// sortedTagKeys returns the keys of the tags in sorted order.
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isValidCommand checks the command is either all letters or a 3 digit
+// numeric.
+//
+// command    =  1*letter / 3digit
+func isValidCommand(command string) bool {
+	if command == "" {
+		return false
+	}
+
+	if len(command) == 3 && isDigit(command[0]) && isDigit(command[1]) &&
+		isDigit(command[2]) {
+		return true
+	}
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// applyInjectionPolicy deals with any CR, LF, or NUL in s according to the
+// policy.
+func applyInjectionPolicy(s string, policy InjectionPolicy) (string, error) {
+	if !strings.ContainsAny(s, "\r\n\x00") {
+		return s, nil
+	}
+
+	switch policy {
+	case InjectionStrip:
+		return injectionStripper.Replace(s), nil
+	case InjectionReplace:
+		return injectionReplacer.Replace(s), nil
+	default:
+		return "", ErrInjection
+	}
+}
+
+var injectionStripper = strings.NewReplacer("\r", "", "\n", "", "\x00", "")
+
+var injectionReplacer = strings.NewReplacer("\r", " ", "\n", " ", "\x00", " ")
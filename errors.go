@@ -0,0 +1,103 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors for error numerics. A NumericError for one of these numerics wraps
+// the matching error, so you can check for it with errors.Is:
+//
+//	if errors.Is(err, ErrNickInUse) {
+var (
+	ErrNoSuchNick        = errors.New("no such nick")
+	ErrNoSuchServer      = errors.New("no such server")
+	ErrNoSuchChannel     = errors.New("no such channel")
+	ErrCannotSendToChan  = errors.New("cannot send to channel")
+	ErrTooManyChannels   = errors.New("too many channels")
+	ErrNoNicknameGiven   = errors.New("no nickname given")
+	ErrErroneousNickname = errors.New("erroneous nickname")
+	ErrNickInUse         = errors.New("nickname is in use")
+	ErrNickCollision     = errors.New("nickname collision")
+	ErrUnavailResource   = errors.New("nick or channel is temporarily unavailable")
+	ErrUserNotInChannel  = errors.New("user is not in channel")
+	ErrNotOnChannel      = errors.New("not on channel")
+	ErrUserOnChannel     = errors.New("user is already on channel")
+	ErrNotRegistered     = errors.New("not registered")
+	ErrNeedMoreParams    = errors.New("not enough parameters")
+	ErrAlreadyRegistered = errors.New("already registered")
+	ErrPasswordMismatch  = errors.New("password incorrect")
+	ErrBannedFromServer  = errors.New("banned from server")
+	ErrChannelIsFull     = errors.New("channel is full")
+	ErrInviteOnlyChan    = errors.New("channel is invite only")
+	ErrBannedFromChan    = errors.New("banned from channel")
+	ErrBadChannelKey     = errors.New("bad channel key")
+	ErrNoPrivileges      = errors.New("no privileges")
+	ErrChanOPrivsNeeded  = errors.New("channel operator privileges needed")
+)
+
+// numericErrors maps error numerics to their errors.
+var numericErrors = map[string]error{
+	ErrorNoSuchNick:        ErrNoSuchNick,
+	ErrorNoSuchServer:      ErrNoSuchServer,
+	ErrorNoSuchChannel:     ErrNoSuchChannel,
+	ErrorCannotSendToChan:  ErrCannotSendToChan,
+	ErrorTooManyChannels:   ErrTooManyChannels,
+	ErrorNoNicknameGiven:   ErrNoNicknameGiven,
+	ErrorErroneusNickname:  ErrErroneousNickname,
+	ErrorNicknameInUse:     ErrNickInUse,
+	ErrorNickCollision:     ErrNickCollision,
+	ErrorUnavailResource:   ErrUnavailResource,
+	ErrorUserNotInChannel:  ErrUserNotInChannel,
+	ErrorNotOnChannel:      ErrNotOnChannel,
+	ErrorUserOnChannel:     ErrUserOnChannel,
+	ErrorNotRegistered:     ErrNotRegistered,
+	ErrorNeedMoreParams:    ErrNeedMoreParams,
+	ErrorAlreadyRegistered: ErrAlreadyRegistered,
+	ErrorPasswdMismatch:    ErrPasswordMismatch,
+	ErrorYoureBannedCreep:  ErrBannedFromServer,
+	ErrorChannelIsFull:     ErrChannelIsFull,
+	ErrorInviteOnlyChan:    ErrInviteOnlyChan,
+	ErrorBannedFromChan:    ErrBannedFromChan,
+	ErrorBadChannelKey:     ErrBadChannelKey,
+	ErrorNoPrivileges:      ErrNoPrivileges,
+	ErrorChanOPrivsNeeded:  ErrChanOPrivsNeeded,
+}
+
+// NumericError is an error numeric reply from the server, such as
+// ERR_NOSUCHCHANNEL.
+type NumericError struct {
+	// Message is the reply.
+	Message Message
+}
+
+// NewNumericError creates a NumericError for the reply.
+func NewNumericError(m Message) *NumericError {
+	return &NumericError{Message: m}
+}
+
+// ErrorFromNumeric returns a *NumericError if the message is an error
+// numeric (400 to 599). Otherwise it returns nil.
+func ErrorFromNumeric(m Message) error {
+	if len(m.Command) != 3 || m.Command < "400" || m.Command > "599" ||
+		!isDigit(m.Command[1]) || !isDigit(m.Command[2]) {
+		return nil
+	}
+	return NewNumericError(m)
+}
+
+// Error returns the numeric along with the server's description. The
+// description is the last parameter.
+func (e *NumericError) Error() string {
+	if len(e.Message.Params) == 0 {
+		return e.Message.Command
+	}
+	return fmt.Sprintf("%s: %s", e.Message.Command,
+		e.Message.Params[len(e.Message.Params)-1])
+}
+
+// Unwrap returns the error for the numeric, such as ErrNickInUse. If we don't
+// have one for the numeric it returns nil.
+func (e *NumericError) Unwrap() error {
+	return numericErrors[e.Message.Command]
+}
@@ -0,0 +1,82 @@
+package irc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNumericErrorIs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+	}{
+		{":irc 403 me #nope :No such channel\r\n", ErrNoSuchChannel},
+		{":irc 404 me #test :Cannot send to channel\r\n", ErrCannotSendToChan},
+		{":irc 405 me #test :You have joined too many channels\r\n",
+			ErrTooManyChannels},
+		{":irc 433 * alice :Nickname is already in use\r\n", ErrNickInUse},
+		{":irc 471 me #test :Cannot join channel (+l)\r\n", ErrChannelIsFull},
+		{":irc 473 me #test :Cannot join channel (+i)\r\n", ErrInviteOnlyChan},
+		{":irc 474 me #test :Cannot join channel (+b)\r\n", ErrBannedFromChan},
+		{":irc 475 me #test :Cannot join channel (+k)\r\n", ErrBadChannelKey},
+		{":irc 482 me #test :You're not channel operator\r\n",
+			ErrChanOPrivsNeeded},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		err = ErrorFromNumeric(m)
+		if !errors.Is(err, test.want) {
+			t.Errorf("ErrorFromNumeric(%q) = %v, wanted %v", test.input, err,
+				test.want)
+			continue
+		}
+
+		// The original message is available.
+		var numErr *NumericError
+		if !errors.As(err, &numErr) || numErr.Message.Command != m.Command {
+			t.Errorf("errors.As(%v) did not give the message", err)
+		}
+
+		if errors.Is(err, ErrNoSuchNick) {
+			t.Errorf("ErrorFromNumeric(%q) is ErrNoSuchNick", test.input)
+		}
+	}
+}
+
+func TestErrorFromNumeric(t *testing.T) {
+	tests := []struct {
+		input string
+		isErr bool
+	}{
+		{":irc 001 me :Welcome\r\n", false},
+		{":irc 372 me :- motd\r\n", false},
+		{":irc PRIVMSG me :hi\r\n", false},
+		{":irc 400 me :Unknown error\r\n", true},
+		{":irc 599 me :Unknown error\r\n", true},
+		{":irc 900 me me!a@h me :Logged in\r\n", false},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		err = ErrorFromNumeric(m)
+		if (err != nil) != test.isErr {
+			t.Errorf("ErrorFromNumeric(%q) = %v, wanted error %v", test.input, err,
+				test.isErr)
+		}
+
+		// Numerics without a matching error still work as errors.
+		if err != nil && errors.Unwrap(err) != nil {
+			t.Errorf("ErrorFromNumeric(%q) unwraps to %v", test.input,
+				errors.Unwrap(err))
+		}
+	}
+}
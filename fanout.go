@@ -0,0 +1,189 @@
+package irc
+
+import (
+	"sync"
+)
+
+// CapSet tells whether a client enabled a capability. ClientCaps implements
+// it.
+type CapSet interface {
+	Enabled(name string) bool
+}
+
+// tagCaps maps tags to the capability a client needs to receive them. Tags
+// not listed here need message-tags.
+var tagCaps = map[string]string{
+	TagTime:    "server-time",
+	TagAccount: "account-tag",
+	TagBatch:   "batch",
+	TagLabel:   "labeled-response",
+}
+
+// commandCaps maps commands to the capability a client needs to receive them
+// at all.
+var commandCaps = map[string]string{
+	"ACCOUNT": "account-notify",
+	"AWAY":    "away-notify",
+	"CHGHOST": "chghost",
+	"SETNAME": "setname",
+	"TAGMSG":  "message-tags",
+}
+
+// fanoutCaps are the capabilities that affect what a client receives. The
+// position of each is its bit in a variant's key.
+var fanoutCaps = []string{
+	"account-notify",
+	"account-tag",
+	"away-notify",
+	"batch",
+	"chghost",
+	"echo-message",
+	"extended-join",
+	"labeled-response",
+	"message-tags",
+	"server-time",
+	"setname",
+}
+
+// Fanout relays a single message to many clients, giving each the form of
+// the message that matches its capabilities.
+//
+// Create one for each message being relayed and call Line for each
+// recipient. Recipients with the same relevant capabilities share the same
+// encoded line, so we encode each variant once.
+//
+// The message is the canonical form of the message, meaning the form a client
+// with every capability gets. It has every tag, and a JOIN is in the
+// extended-join form (channel, account, real name).
+//
+// It is safe for concurrent use.
+type Fanout struct {
+	message Message
+
+	mu       sync.Mutex
+	variants map[uint]fanoutVariant
+}
+
+type fanoutVariant struct {
+	line string
+	ok   bool
+	err  error
+}
+
+// NewFanout creates a Fanout for a message.
+func NewFanout(m Message) *Fanout {
+	return &Fanout{
+		message:  m,
+		variants: map[uint]fanoutVariant{},
+	}
+}
+
+// Message returns the form of the message for a client with the given
+// capabilities. source is true if the client sent the message.
+//
+// If the client should not receive the message, we return false. This is the
+// case if the message is the client's own and it did not enable
+// echo-message, or if the command needs a capability the client lacks.
+func (f *Fanout) Message(caps CapSet, source bool) (Message, bool) {
+	if source && !caps.Enabled("echo-message") {
+		return Message{}, false
+	}
+
+	if capability, ok := commandCaps[f.message.Command]; ok &&
+		!caps.Enabled(capability) {
+		return Message{}, false
+	}
+
+	m := Message{
+		Prefix:  f.message.Prefix,
+		Command: f.message.Command,
+		Params:  f.message.Params,
+	}
+
+	for key, value := range f.message.Tags {
+		// A label is for the client that sent the command only.
+		if key == TagLabel && !source {
+			continue
+		}
+
+		capability, ok := tagCaps[key]
+		if !ok {
+			capability = "message-tags"
+		}
+		if !caps.Enabled(capability) {
+			continue
+		}
+
+		if m.Tags == nil {
+			m.Tags = map[string]string{}
+		}
+		m.Tags[key] = value
+	}
+
+	if m.Command == "JOIN" && len(m.Params) > 1 &&
+		!caps.Enabled("extended-join") {
+		m.Params = m.Params[:1]
+	}
+
+	return m, true
+}
+
+// Line returns the encoded form of the message for a client with the given
+// capabilities. See Message.
+//
+// We encode each variant once and return the same line for later clients
+// with the same capabilities.
+func (f *Fanout) Line(caps CapSet, source bool) (string, bool, error) {
+	key := variantKey(caps, source)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if v, ok := f.variants[key]; ok {
+		return v.line, v.ok, v.err
+	}
+
+	var v fanoutVariant
+	m, ok := f.Message(caps, source)
+	if ok {
+		v.line, v.err = m.Encode()
+		v.ok = v.err == nil || v.err == ErrTruncated
+	}
+
+	f.variants[key] = v
+	return v.line, v.ok, v.err
+}
+
+// variantKey computes a key identifying the variant of a message a client
+// gets.
+func variantKey(caps CapSet, source bool) uint {
+	var key uint
+	for i, capability := range fanoutCaps {
+		if caps.Enabled(capability) {
+			key |= 1 << uint(i)
+		}
+	}
+	if source {
+		key |= 1 << uint(len(fanoutCaps))
+	}
+	return key
+}
+
+// CapNames is a CapSet holding capability names. It is useful where a client's
+// capabilities are tracked some other way than ClientCaps.
+type CapNames map[string]struct{}
+
+// NewCapNames creates a CapNames holding the given capabilities.
+func NewCapNames(names ...string) CapNames {
+	c := CapNames{}
+	for _, name := range names {
+		c[name] = struct{}{}
+	}
+	return c
+}
+
+// Enabled returns true if the capability is in the set.
+func (c CapNames) Enabled(name string) bool {
+	_, ok := c[name]
+	return ok
+}
@@ -0,0 +1,112 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestFanoutLine(t *testing.T) {
+	privmsg := Message{
+		Tags: map[string]string{
+			"time":    "2020-01-02T03:04:05.000Z",
+			"account": "alice",
+			"msgid":   "abc",
+			"+typing": "done",
+			"label":   "l1",
+		},
+		Prefix:  "alice!a@h",
+		Command: "PRIVMSG",
+		Params:  []string{"#test", "hi there"},
+	}
+
+	join := Message{
+		Tags:    map[string]string{"time": "2020-01-02T03:04:05.000Z"},
+		Prefix:  "alice!a@h",
+		Command: "JOIN",
+		Params:  []string{"#test", "alice", "Alice A"},
+	}
+
+	away := Message{
+		Prefix:  "alice!a@h",
+		Command: "AWAY",
+		Params:  []string{"gone"},
+	}
+
+	tests := []struct {
+		message Message
+		caps    CapNames
+		source  bool
+		line    string
+		ok      bool
+	}{
+		{privmsg, NewCapNames(), false,
+			":alice!a@h PRIVMSG #test :hi there\r\n", true},
+		{privmsg, NewCapNames("server-time"), false,
+			"@time=2020-01-02T03:04:05.000Z :alice!a@h PRIVMSG #test :hi there\r\n",
+			true},
+		{privmsg, NewCapNames("account-tag", "message-tags"), false,
+			"@+typing=done;account=alice;msgid=abc :alice!a@h PRIVMSG #test :hi there\r\n",
+			true},
+		// The source only gets its own message with echo-message.
+		{privmsg, NewCapNames("server-time"), true, "", false},
+		// Only the source gets the label.
+		{privmsg, NewCapNames("echo-message", "labeled-response"), true,
+			"@label=l1 :alice!a@h PRIVMSG #test :hi there\r\n", true},
+		{privmsg, NewCapNames("labeled-response"), false,
+			":alice!a@h PRIVMSG #test :hi there\r\n", true},
+		{join, NewCapNames(), false, ":alice!a@h JOIN #test\r\n", true},
+		{join, NewCapNames("extended-join", "server-time"), false,
+			"@time=2020-01-02T03:04:05.000Z :alice!a@h JOIN #test alice :Alice A\r\n",
+			true},
+		{away, NewCapNames(), false, "", false},
+		{away, NewCapNames("away-notify"), false, ":alice!a@h AWAY gone\r\n",
+			true},
+	}
+
+	for _, test := range tests {
+		f := NewFanout(test.message)
+
+		// Ask twice so we exercise the cache.
+		for i := 0; i < 2; i++ {
+			line, ok, err := f.Line(test.caps, test.source)
+			if err != nil {
+				t.Errorf("Line(%v, %v) for %s = error %s", test.caps, test.source,
+					test.message, err)
+				continue
+			}
+			if line != test.line || ok != test.ok {
+				t.Errorf("Line(%v, %v) for %s = %q, %v, wanted %q, %v", test.caps,
+					test.source, test.message, line, ok, test.line, test.ok)
+			}
+		}
+	}
+}
+
+func TestFanoutSharesVariants(t *testing.T) {
+	f := NewFanout(Message{
+		Tags:    map[string]string{"time": "2020-01-02T03:04:05.000Z"},
+		Prefix:  "alice!a@h",
+		Command: "PRIVMSG",
+		Params:  []string{"#test", "hi"},
+	})
+
+	registry := NewCapRegistry(Capability{Name: "server-time"},
+		Capability{Name: "multi-prefix"})
+
+	for _, req := range []string{"server-time", "server-time multi-prefix",
+		"multi-prefix"} {
+		c := NewClientCaps(registry, "irc")
+		if _, err := c.Handle(Message{Command: "CAP",
+			Params: []string{"REQ", req}}, "*"); err != nil {
+			t.Fatalf("Handle() = %s", err)
+		}
+
+		if _, _, err := f.Line(c, false); err != nil {
+			t.Fatalf("Line() = %s", err)
+		}
+	}
+
+	// multi-prefix does not affect the message, so there are two variants.
+	if len(f.variants) != 2 {
+		t.Errorf("got %d variants, wanted 2", len(f.variants))
+	}
+}
@@ -0,0 +1,311 @@
+package irc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrFloodWriterClosed is the error sending to a closed FloodWriter gives.
+var ErrFloodWriterClosed = errors.New("flood writer closed")
+
+// FloodConfig describes how fast we may send.
+//
+// Sending a message costs PerMessage plus PerByte for each byte of the line.
+// We track when the cost of everything we have sent will be paid off. We may
+// send while that time is no more than Burst in the future. This is the
+// scheme ircds such as ircu and hybrid use to decide to disconnect a client
+// for Excess Flood.
+type FloodConfig struct {
+	// PerMessage is the cost of each message.
+	PerMessage time.Duration
+
+	// PerByte is the cost of each byte, including the CRLF.
+	PerByte time.Duration
+
+	// Burst is how far ahead we may get.
+	Burst time.Duration
+}
+
+// DefaultFloodConfig is a conservative config. It charges 2 seconds per
+// message and 1 second per 120 bytes, and allows a burst of 10 seconds. This
+// is what ircu does.
+var DefaultFloodConfig = FloodConfig{
+	PerMessage: 2 * time.Second,
+	PerByte:    time.Second / 120,
+	Burst:      10 * time.Second,
+}
+
+// FloodLimiter queues messages and decides when to send them. It does no I/O
+// and has no clock of its own. FloodWriter uses it.
+//
+// PING, PONG, and QUIT go ahead of other queued messages. They still count
+// against the limit.
+//
+// It is not safe for concurrent use.
+type FloodLimiter struct {
+	config FloodConfig
+
+	// paid is when the cost of what we have sent is paid off.
+	paid time.Time
+
+	priority []string
+	normal   []string
+}
+
+// NewFloodLimiter creates a FloodLimiter.
+func NewFloodLimiter(config FloodConfig) *FloodLimiter {
+	return &FloodLimiter{config: config}
+}
+
+// Enqueue adds a message to the queue.
+func (l *FloodLimiter) Enqueue(m Message) error {
+	buf, err := m.Encode()
+	if err != nil {
+		return fmt.Errorf("error encoding message: %s", err)
+	}
+
+	if isPriorityCommand(m.Command) {
+		l.priority = append(l.priority, buf)
+		return nil
+	}
+	l.normal = append(l.normal, buf)
+	return nil
+}
+
+// Next returns the next line to send if we may send it now. If we may not, it
+// returns how long to wait. The wait is zero if the queue is empty.
+func (l *FloodLimiter) Next(now time.Time) (string, time.Duration, bool) {
+	if l.Len() == 0 {
+		return "", 0, false
+	}
+
+	if l.paid.Before(now) {
+		l.paid = now
+	}
+
+	if wait := l.paid.Sub(now) - l.config.Burst; wait > 0 {
+		return "", wait, false
+	}
+
+	var line string
+	if len(l.priority) > 0 {
+		line = l.priority[0]
+		l.priority = l.priority[1:]
+	} else {
+		line = l.normal[0]
+		l.normal = l.normal[1:]
+	}
+
+	l.paid = l.paid.Add(l.cost(line))
+	return line, 0, true
+}
+
+// Len returns how many messages are queued.
+func (l *FloodLimiter) Len() int {
+	return len(l.priority) + len(l.normal)
+}
+
+func (l *FloodLimiter) cost(line string) time.Duration {
+	return l.config.PerMessage + time.Duration(len(line))*l.config.PerByte
+}
+
+// isPriorityCommand returns true if messages with the command should go
+// ahead of others. These are ones where a delay could get us disconnected or
+// where nothing else matters anymore.
+func isPriorityCommand(command string) bool {
+	switch command {
+	case "PING", "PONG", "QUIT":
+		return true
+	}
+	return false
+}
+
+// FloodWriter writes messages to a writer no faster than a FloodConfig
+// allows. Messages wait in a queue until they may be sent.
+//
+// It is safe for concurrent use.
+type FloodWriter struct {
+	w io.Writer
+
+	// now and after tell the time. We replace them in tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	mu      sync.Mutex
+	limiter *FloodLimiter
+	err     error
+
+	// writing is true while we write a line.
+	writing bool
+
+	// flushed holds channels to close once the queue is empty.
+	flushed []chan struct{}
+
+	wake      chan struct{}
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFloodWriter creates a FloodWriter. It starts writing right away. Call
+// Close when you are done with it.
+func NewFloodWriter(w io.Writer, config FloodConfig) *FloodWriter {
+	return newFloodWriter(w, config, time.Now, time.After)
+}
+
+func newFloodWriter(w io.Writer, config FloodConfig, now func() time.Time,
+	after func(time.Duration) <-chan time.Time) *FloodWriter {
+	fw := &FloodWriter{
+		w:       w,
+		now:     now,
+		after:   after,
+		limiter: NewFloodLimiter(config),
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go fw.loop()
+
+	return fw
+}
+
+// Send queues a message. It returns an error if a write failed or we are
+// closed.
+func (fw *FloodWriter) Send(m Message) error {
+	fw.mu.Lock()
+	if fw.err != nil {
+		err := fw.err
+		fw.mu.Unlock()
+		return err
+	}
+	err := fw.limiter.Enqueue(m)
+	fw.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case fw.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Queued returns how many messages are waiting to be written.
+func (fw *FloodWriter) Queued() int {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.limiter.Len()
+}
+
+// Flush waits until every queued message is written. It returns an error if
+// the context ends first or if we stop, such as because a write failed.
+func (fw *FloodWriter) Flush(ctx context.Context) error {
+	fw.mu.Lock()
+	if fw.err != nil {
+		err := fw.err
+		fw.mu.Unlock()
+		return err
+	}
+	if fw.limiter.Len() == 0 && !fw.writing {
+		fw.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	fw.flushed = append(fw.flushed, ch)
+	fw.mu.Unlock()
+
+	select {
+	case <-ch:
+		return fw.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Err returns the error that stopped us, if any.
+func (fw *FloodWriter) Err() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.err
+}
+
+// Close stops writing. We drop any queued messages, so call Flush first to
+// send them. It does not close the underlying writer.
+func (fw *FloodWriter) Close() error {
+	fw.closeOnce.Do(func() {
+		fw.setErr(ErrFloodWriterClosed)
+		close(fw.quit)
+	})
+	<-fw.done
+	return nil
+}
+
+func (fw *FloodWriter) loop() {
+	defer close(fw.done)
+	defer fw.notifyFlushed(true)
+
+	for {
+		fw.mu.Lock()
+		line, wait, ok := fw.limiter.Next(fw.now())
+		fw.writing = ok
+		fw.mu.Unlock()
+
+		if ok {
+			_, err := io.WriteString(fw.w, line)
+
+			fw.mu.Lock()
+			fw.writing = false
+			fw.mu.Unlock()
+
+			if err != nil {
+				fw.setErr(fmt.Errorf("error writing: %s", err))
+				return
+			}
+			continue
+		}
+
+		fw.notifyFlushed(false)
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = fw.after(wait)
+		}
+
+		select {
+		case <-fw.wake:
+		case <-timer:
+		case <-fw.quit:
+			return
+		}
+	}
+}
+
+// notifyFlushed wakes Flush calls if there is nothing left to write. If we
+// stopped we wake them regardless.
+func (fw *FloodWriter) notifyFlushed(stopped bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if !stopped && (fw.limiter.Len() > 0 || fw.writing) {
+		return
+	}
+
+	for _, ch := range fw.flushed {
+		close(ch)
+	}
+	fw.flushed = nil
+}
+
+func (fw *FloodWriter) setErr(err error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.err == nil {
+		fw.err = err
+	}
+}
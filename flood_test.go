@@ -0,0 +1,314 @@
+package irc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFloodLimiter(t *testing.T) {
+	l := NewFloodLimiter(FloodConfig{
+		PerMessage: time.Second,
+		PerByte:    100 * time.Millisecond,
+		Burst:      3 * time.Second,
+	})
+
+	// Each of these is 10 bytes so costs 2 seconds.
+	for _, text := range []string{"a", "b", "c", "d"} {
+		if err := l.Enqueue(Message{Command: "NOTICE",
+			Params: []string{text}}); err != nil {
+			t.Fatalf("Enqueue() = %s", err)
+		}
+	}
+
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		now  time.Duration
+		line string
+		wait time.Duration
+		ok   bool
+	}{
+		// Paid off at 0, so we may send. Now paid off at 2.
+		{0, "NOTICE a\r\n", 0, true},
+		// 2 ahead is within the burst. Now paid off at 4.
+		{0, "NOTICE b\r\n", 0, true},
+		// 4 ahead is 1 over the burst.
+		{0, "", time.Second, false},
+		{500 * time.Millisecond, "", 500 * time.Millisecond, false},
+		// Now paid off at 6.
+		{time.Second, "NOTICE c\r\n", 0, true},
+		{time.Second, "", 2 * time.Second, false},
+		// We fell behind, so we start from now. Paid off at 22.
+		{20 * time.Second, "NOTICE d\r\n", 0, true},
+		{20 * time.Second, "", 0, false},
+	}
+
+	for i, test := range tests {
+		line, wait, ok := l.Next(start.Add(test.now))
+		if line != test.line || wait != test.wait || ok != test.ok {
+			t.Errorf("step %d: Next(+%s) = %q, %s, %v, wanted %q, %s, %v", i,
+				test.now, line, wait, ok, test.line, test.wait, test.ok)
+		}
+	}
+
+	if l.Len() != 0 {
+		t.Errorf("Len() = %d, wanted 0", l.Len())
+	}
+}
+
+func TestFloodLimiterPriority(t *testing.T) {
+	l := NewFloodLimiter(FloodConfig{PerMessage: time.Second})
+
+	msgs := []Message{
+		{Command: "PRIVMSG", Params: []string{"#a", "one"}},
+		{Command: "PRIVMSG", Params: []string{"#a", "two"}},
+		{Command: "PONG", Params: []string{"x"}},
+		{Command: "QUIT", Params: []string{"bye"}},
+	}
+	for _, m := range msgs {
+		if err := l.Enqueue(m); err != nil {
+			t.Fatalf("Enqueue() = %s", err)
+		}
+	}
+
+	if l.Len() != 4 {
+		t.Errorf("Len() = %d, wanted 4", l.Len())
+	}
+
+	want := []string{
+		"PONG x\r\n",
+		"QUIT bye\r\n",
+		"PRIVMSG #a one\r\n",
+		"PRIVMSG #a two\r\n",
+	}
+
+	now := time.Unix(1000, 0)
+	for _, w := range want {
+		line, wait, ok := l.Next(now)
+		if !ok {
+			now = now.Add(wait)
+			line, _, ok = l.Next(now)
+		}
+		if !ok || line != w {
+			t.Errorf("Next() = %q, %v, wanted %q", line, ok, w)
+		}
+	}
+}
+
+func TestFloodLimiterEncodeError(t *testing.T) {
+	l := NewFloodLimiter(DefaultFloodConfig)
+	if err := l.Enqueue(Message{Command: "PRIVMSG",
+		Params: []string{"a\r\nQUIT"}}); err == nil {
+		t.Errorf("Enqueue() of invalid message succeeded, wanted error")
+	}
+	if l.Len() != 0 {
+		t.Errorf("Len() = %d, wanted 0", l.Len())
+	}
+}
+
+// fakeClock is a clock we advance by hand.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0), waiting: make(chan struct{}, 10)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.waiting <- struct{}{}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	var timers []fakeTimer
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			timers = append(timers, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = timers
+}
+
+// lineWriter passes each write to a channel.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func (w lineWriter) expect(t *testing.T, want string) {
+	select {
+	case got := <-w:
+		if got != want {
+			t.Errorf("wrote %q, wanted %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("timed out waiting for %q", want)
+	}
+}
+
+func TestFloodWriter(t *testing.T) {
+	clock := newFakeClock()
+	w := make(lineWriter, 10)
+	fw := newFloodWriter(w, FloodConfig{PerMessage: time.Second,
+		Burst: time.Second}, clock.Now, clock.After)
+	defer func() { _ = fw.Close() }()
+
+	for _, text := range []string{"one", "two", "three", "four"} {
+		if err := fw.Send(Message{Command: "PRIVMSG",
+			Params: []string{"#a", text}}); err != nil {
+			t.Fatalf("Send() = %s", err)
+		}
+	}
+
+	w.expect(t, "PRIVMSG #a one\r\n")
+	w.expect(t, "PRIVMSG #a two\r\n")
+
+	// The writer is now waiting for the clock.
+	<-clock.waiting
+	if n := fw.Queued(); n != 2 {
+		t.Errorf("Queued() = %d, wanted 2", n)
+	}
+
+	// A PONG goes ahead of what is queued.
+	if err := fw.Send(Message{Command: "PONG",
+		Params: []string{"x"}}); err != nil {
+		t.Fatalf("Send() = %s", err)
+	}
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+	w.expect(t, "PONG x\r\n")
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+	w.expect(t, "PRIVMSG #a three\r\n")
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+	w.expect(t, "PRIVMSG #a four\r\n")
+
+	if n := fw.Queued(); n != 0 {
+		t.Errorf("Queued() = %d, wanted 0", n)
+	}
+}
+
+func TestFloodWriterFlush(t *testing.T) {
+	clock := newFakeClock()
+	w := make(lineWriter, 10)
+	fw := newFloodWriter(w, FloodConfig{PerMessage: time.Second}, clock.Now,
+		clock.After)
+	defer func() { _ = fw.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := fw.Flush(ctx); err != nil {
+		t.Fatalf("Flush() with nothing queued = %s", err)
+	}
+
+	for _, text := range []string{"one", "two"} {
+		if err := fw.Send(Message{Command: "PRIVMSG",
+			Params: []string{"#a", text}}); err != nil {
+			t.Fatalf("Send() = %s", err)
+		}
+	}
+
+	w.expect(t, "PRIVMSG #a one\r\n")
+	<-clock.waiting
+
+	// The second message is waiting for the clock.
+	expired, cancelExpired := context.WithCancel(context.Background())
+	cancelExpired()
+	if err := fw.Flush(expired); err != context.Canceled {
+		t.Errorf("Flush() with a cancelled context = %v, wanted %s", err,
+			context.Canceled)
+	}
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- fw.Flush(ctx) }()
+
+	clock.Advance(time.Second)
+	w.expect(t, "PRIVMSG #a two\r\n")
+
+	if err := <-flushed; err != nil {
+		t.Errorf("Flush() = %s", err)
+	}
+	if n := fw.Queued(); n != 0 {
+		t.Errorf("Queued() = %d, wanted 0", n)
+	}
+}
+
+func TestFloodWriterFlushClosed(t *testing.T) {
+	clock := newFakeClock()
+	w := make(lineWriter, 10)
+	fw := newFloodWriter(w, FloodConfig{PerMessage: time.Hour}, clock.Now,
+		clock.After)
+
+	for _, text := range []string{"one", "two"} {
+		if err := fw.Send(Message{Command: "PRIVMSG",
+			Params: []string{"#a", text}}); err != nil {
+			t.Fatalf("Send() = %s", err)
+		}
+	}
+	w.expect(t, "PRIVMSG #a one\r\n")
+	<-clock.waiting
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- fw.Flush(context.Background()) }()
+
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	select {
+	case err := <-flushed:
+		if !errors.Is(err, ErrFloodWriterClosed) {
+			t.Errorf("Flush() = %v, wanted %s", err, ErrFloodWriterClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Flush() did not return after Close()")
+	}
+}
+
+func TestFloodWriterClose(t *testing.T) {
+	fw := NewFloodWriter(make(lineWriter, 10), DefaultFloodConfig)
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	err := fw.Send(Message{Command: "PING", Params: []string{"x"}})
+	if !errors.Is(err, ErrFloodWriterClosed) {
+		t.Errorf("Send() after Close() = %v, wanted %s", err,
+			ErrFloodWriterClosed)
+	}
+}
@@ -0,0 +1,290 @@
+// Package format provides parsing of the formatting control codes found in
+// IRC message text (bold, colours, and so on).
+//
+// The codes it understands are those described at
+// https://modern.ircdocs.horse/formatting.html. Text is parsed into Spans,
+// each of which is a run of text with a single Style. Helpers are provided to
+// strip formatting entirely and to render formatted text for ANSI terminals
+// and HTML.
+package format
+
+import "strings"
+
+// Formatting control codes.
+const (
+	CodeBold          = '\x02'
+	CodeColour        = '\x03'
+	CodeHexColour     = '\x04'
+	CodeReset         = '\x0f'
+	CodeMonospace     = '\x11'
+	CodeReverse       = '\x16'
+	CodeItalic        = '\x1d'
+	CodeStrikethrough = '\x1e'
+	CodeUnderline     = '\x1f'
+)
+
+// DefaultColour is the colour code that means to use the client's default
+// colour. We treat it as no colour.
+const DefaultColour = 99
+
+// Colour is a foreground or background colour.
+//
+// The zero value means no colour is set.
+type Colour struct {
+	// Set is true if there is a colour.
+	Set bool
+
+	// Hex is true if the colour was given as a hex colour (via \x04). In that
+	// case RGB holds it. Otherwise Code holds the palette colour code (0-98).
+	Hex bool
+
+	Code int
+
+	RGB uint32
+}
+
+// PaletteColour returns a Colour for the given palette colour code.
+func PaletteColour(code int) Colour {
+	return Colour{Set: true, Code: code}
+}
+
+// HexColour returns a Colour for the given 24 bit RGB value.
+func HexColour(rgb uint32) Colour {
+	return Colour{Set: true, Hex: true, RGB: rgb & 0xffffff}
+}
+
+// Value returns the colour as a 24 bit RGB value. For palette colours we
+// return the colour's usual RGB value.
+//
+// It returns false if no colour is set.
+func (c Colour) Value() (uint32, bool) {
+	if !c.Set {
+		return 0, false
+	}
+	if c.Hex {
+		return c.RGB, true
+	}
+	if c.Code < 0 || c.Code >= len(palette) {
+		return 0, false
+	}
+	return palette[c.Code].rgb, true
+}
+
+// Style describes the formatting applied to a run of text.
+//
+// The zero value is unformatted text.
+type Style struct {
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+	Monospace     bool
+	Reverse       bool
+
+	Foreground Colour
+	Background Colour
+}
+
+// IsZero returns true if the style applies no formatting.
+func (s Style) IsZero() bool {
+	return s == Style{}
+}
+
+// Span is a run of text with a single style.
+type Span struct {
+	Style Style
+	Text  string
+}
+
+// Parse breaks text into spans according to the formatting codes it contains.
+//
+// The returned spans do not include any formatting codes. Spans with no text
+// are not included. Concatenating the text of each span gives the same result
+// as Strip.
+//
+// Malformed codes are handled leniently. For example a colour code followed by
+// no digits resets colours, as it does in most clients.
+func Parse(text string) []Span {
+	var spans []Span
+	style := Style{}
+	start := 0
+
+	flush := func(end int) {
+		if end > start {
+			spans = append(spans, Span{Style: style, Text: text[start:end]})
+		}
+	}
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case CodeBold:
+			flush(i)
+			style.Bold = !style.Bold
+			i++
+		case CodeItalic:
+			flush(i)
+			style.Italic = !style.Italic
+			i++
+		case CodeUnderline:
+			flush(i)
+			style.Underline = !style.Underline
+			i++
+		case CodeStrikethrough:
+			flush(i)
+			style.Strikethrough = !style.Strikethrough
+			i++
+		case CodeMonospace:
+			flush(i)
+			style.Monospace = !style.Monospace
+			i++
+		case CodeReverse:
+			flush(i)
+			style.Reverse = !style.Reverse
+			i++
+		case CodeReset:
+			flush(i)
+			style = Style{}
+			i++
+		case CodeColour:
+			flush(i)
+			i = parseColour(text, i+1, &style)
+		case CodeHexColour:
+			flush(i)
+			i = parseHexColour(text, i+1, &style)
+		default:
+			i++
+			continue
+		}
+		start = i
+	}
+
+	flush(len(text))
+
+	return spans
+}
+
+// parseColour parses the arguments to a \x03 colour code. index points just
+// after the code. We update the style and return the index after the
+// arguments.
+//
+// The format is \x03[fg[,bg]] where each colour is one or two digits.
+func parseColour(text string, index int, style *Style) int {
+	fg, n := parseDigits(text, index)
+	if n == 0 {
+		style.Foreground = Colour{}
+		style.Background = Colour{}
+		return index
+	}
+	index += n
+	style.Foreground = paletteOrDefault(fg)
+
+	// A comma is only part of the code if digits follow it.
+	if index+1 < len(text) && text[index] == ',' {
+		bg, n := parseDigits(text, index+1)
+		if n > 0 {
+			index += 1 + n
+			style.Background = paletteOrDefault(bg)
+		}
+	}
+
+	return index
+}
+
+// parseDigits parses up to two decimal digits starting at index. It returns
+// the value and the number of digits read.
+func parseDigits(text string, index int) (int, int) {
+	value := 0
+	n := 0
+	for n < 2 && index+n < len(text) && isDigit(text[index+n]) {
+		value = value*10 + int(text[index+n]-'0')
+		n++
+	}
+	return value, n
+}
+
+func paletteOrDefault(code int) Colour {
+	if code == DefaultColour {
+		return Colour{}
+	}
+	return PaletteColour(code)
+}
+
+// parseHexColour parses the arguments to a \x04 hex colour code. index points
+// just after the code. We update the style and return the index after the
+// arguments.
+//
+// The format is \x04[RRGGBB[,RRGGBB]].
+func parseHexColour(text string, index int, style *Style) int {
+	fg, ok := parseHex(text, index)
+	if !ok {
+		style.Foreground = Colour{}
+		style.Background = Colour{}
+		return index
+	}
+	index += 6
+	style.Foreground = HexColour(fg)
+
+	if index < len(text) && text[index] == ',' {
+		bg, ok := parseHex(text, index+1)
+		if ok {
+			index += 7
+			style.Background = HexColour(bg)
+		}
+	}
+
+	return index
+}
+
+// parseHex parses exactly six hex digits starting at index.
+func parseHex(text string, index int) (uint32, bool) {
+	if index+6 > len(text) {
+		return 0, false
+	}
+
+	var value uint32
+	for i := index; i < index+6; i++ {
+		c := text[i]
+		switch {
+		case isDigit(c):
+			value = value<<4 | uint32(c-'0')
+		case c >= 'a' && c <= 'f':
+			value = value<<4 | uint32(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			value = value<<4 | uint32(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+
+	return value, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Strip removes all formatting codes from text, including the arguments to
+// colour codes.
+func Strip(text string) string {
+	if !hasCodes(text) {
+		return text
+	}
+
+	var b strings.Builder
+	for _, span := range Parse(text) {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+// hasCodes returns true if the text contains any formatting code.
+func hasCodes(text string) bool {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case CodeBold, CodeColour, CodeHexColour, CodeReset, CodeMonospace,
+			CodeReverse, CodeItalic, CodeStrikethrough, CodeUnderline:
+			return true
+		}
+	}
+	return false
+}
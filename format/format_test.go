@@ -0,0 +1,341 @@
+package format
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		output []Span
+	}{
+		{"", nil},
+		{"hi there", []Span{{Text: "hi there"}}},
+		{
+			"a \x02bold\x02 b",
+			[]Span{
+				{Text: "a "},
+				{Style: Style{Bold: true}, Text: "bold"},
+				{Text: " b"},
+			},
+		},
+		{
+			"\x02\x1d\x1f\x1e\x11\x16x\x0fy",
+			[]Span{
+				{
+					Style: Style{Bold: true, Italic: true, Underline: true,
+						Strikethrough: true, Monospace: true, Reverse: true},
+					Text: "x",
+				},
+				{Text: "y"},
+			},
+		},
+		{
+			"\x034red\x03 plain",
+			[]Span{
+				{Style: Style{Foreground: PaletteColour(4)}, Text: "red"},
+				{Text: " plain"},
+			},
+		},
+		{
+			"\x0304,12x",
+			[]Span{
+				{
+					Style: Style{Foreground: PaletteColour(4),
+						Background: PaletteColour(12)},
+					Text: "x",
+				},
+			},
+		},
+
+		// Only two digits are part of the code.
+		{
+			"\x03123",
+			[]Span{{Style: Style{Foreground: PaletteColour(12)}, Text: "3"}},
+		},
+
+		// A comma without a following digit is text.
+		{
+			"\x034,x",
+			[]Span{{Style: Style{Foreground: PaletteColour(4)}, Text: ",x"}},
+		},
+		{
+			"\x034,",
+			[]Span{{Style: Style{Foreground: PaletteColour(4)}, Text: ","}},
+		},
+
+		// Setting only the foreground keeps the background.
+		{
+			"\x031,2a\x035b",
+			[]Span{
+				{
+					Style: Style{Foreground: PaletteColour(1),
+						Background: PaletteColour(2)},
+					Text: "a",
+				},
+				{
+					Style: Style{Foreground: PaletteColour(5),
+						Background: PaletteColour(2)},
+					Text: "b",
+				},
+			},
+		},
+
+		// 99 is the default colour.
+		{"\x0399,99x", []Span{{Text: "x"}}},
+
+		{
+			"\x04ff8800,000000x\x04y",
+			[]Span{
+				{
+					Style: Style{Foreground: HexColour(0xff8800),
+						Background: HexColour(0)},
+					Text: "x",
+				},
+				{Text: "y"},
+			},
+		},
+
+		// Not enough hex digits. The code resets colours.
+		{"\x04ff88x", []Span{{Text: "ff88x"}}},
+	}
+
+	for _, test := range tests {
+		got := Parse(test.input)
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("Parse(%q) = %+v, wanted %+v", test.input, got, test.output)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{"", ""},
+		{"hi", "hi"},
+		{"\x02hi\x02", "hi"},
+		{"\x0304,12hi\x03 there", "hi there"},
+		{"\x0312,", ","},
+		{"\x04aabbcc,ddeeffhi\x0f", "hi"},
+		{"\x1d\x1f\x1e\x11\x16hi", "hi"},
+		{"a\x03,4b", "a,4b"},
+	}
+
+	for _, test := range tests {
+		got := Strip(test.input)
+		if got != test.output {
+			t.Errorf("Strip(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+	}
+}
+
+func TestANSI(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{"hi", "hi"},
+		{"\x02hi\x02 there", "\x1b[0;1mhi\x1b[0m there"},
+		{"\x034,2hi", "\x1b[0;38;5;9;48;5;4mhi\x1b[0m"},
+		{"\x04102030hi", "\x1b[0;38;2;16;32;48mhi\x1b[0m"},
+		{"\x1d\x1fa\x16b", "\x1b[0;3;4ma\x1b[0;3;4;7mb\x1b[0m"},
+		{"\x0370x", "\x1b[0;38;5;87mx\x1b[0m"},
+	}
+
+	for _, test := range tests {
+		got := ANSI(test.input)
+		if got != test.output {
+			t.Errorf("ANSI(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{"<b>&", "&lt;b&gt;&amp;"},
+		{
+			"\x02hi\x02 <there>",
+			`<span style="font-weight:bold">hi</span> &lt;there&gt;`,
+		},
+		{
+			"\x1f\x1e\x11x",
+			`<span style="text-decoration:underline line-through;` +
+				`font-family:monospace">x</span>`,
+		},
+		{
+			"\x034,8x",
+			`<span style="color:#ff0000;background-color:#ffff00">x</span>`,
+		},
+		{
+			"\x16x",
+			`<span style="color:#ffffff;background-color:#000000">x</span>`,
+		},
+		{
+			"\x04abcdefx",
+			`<span style="color:#abcdef">x</span>`,
+		},
+	}
+
+	for _, test := range tests {
+		got := HTML(test.input)
+		if got != test.output {
+			t.Errorf("HTML(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+	}
+}
+
+func TestFromMarkdown(t *testing.T) {
+	tests := []struct {
+		input  string
+		opts   MarkdownOptions
+		output string
+	}{
+		{"plain", MarkdownOptions{}, "plain"},
+		{"**bold** and __bold__", MarkdownOptions{}, "\x02bold\x02 and \x02bold\x02"},
+		{"*it* _it_", MarkdownOptions{}, "\x1dit\x1d \x1dit\x1d"},
+		{"~~gone~~", MarkdownOptions{}, "\x1egone\x1e"},
+		{"**a *b* c**", MarkdownOptions{}, "\x02a \x1db\x1d c\x02"},
+		{"*a **b** c*", MarkdownOptions{}, "\x1da \x02b\x02 c\x1d"},
+		{"run `go test` now", MarkdownOptions{}, "run \x11go test\x11 now"},
+		{"`**not bold**`", MarkdownOptions{}, "\x11**not bold**\x11"},
+		{"`` a`b ``", MarkdownOptions{}, "\x11a`b\x11"},
+		{"snake_case_name", MarkdownOptions{}, "snake_case_name"},
+		{"2 * 3 * 4", MarkdownOptions{}, "2 * 3 * 4"},
+		{"**unclosed", MarkdownOptions{}, "**unclosed"},
+		{`\*literal\*`, MarkdownOptions{}, "*literal*"},
+		{
+			"see [the docs](https://example.com/x)",
+			MarkdownOptions{},
+			"see the docs (https://example.com/x)",
+		},
+		{
+			"[https://example.com](https://example.com)",
+			MarkdownOptions{},
+			"https://example.com",
+		},
+		{"[not a link] (x)", MarkdownOptions{}, "[not a link] (x)"},
+		{
+			"[**b**](http://x)",
+			MarkdownOptions{LinkColour: PaletteColour(12)},
+			"\x02b\x02 (\x0312http://x\x03)",
+		},
+		{
+			"`x`",
+			MarkdownOptions{CodeColour: PaletteColour(3)},
+			"\x0303\x11x\x11\x03",
+		},
+		// Digits after the colour ends must not be read as a colour.
+		{
+			"run `make`1 time",
+			MarkdownOptions{CodeColour: PaletteColour(4)},
+			"run \x0304\x11make\x11\x03\x02\x021 time",
+		},
+		{
+			"[http://x](http://x)2",
+			MarkdownOptions{LinkColour: PaletteColour(12)},
+			"\x0312http://x\x03\x02\x022",
+		},
+	}
+
+	for _, test := range tests {
+		got := FromMarkdown(test.input, test.opts)
+		if got != test.output {
+			t.Errorf("FromMarkdown(%q) = %q, wanted %q", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxBytes int
+		output   []string
+	}{
+		{"", 10, nil},
+		{"hello", 10, []string{"hello"}},
+		{"hello there world", 11, []string{"hello there", "world"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"one\ntwo", 10, []string{"one", "two"}},
+
+		// Formatting is restored at the start of the next line.
+		{
+			"\x02bold text here\x02 done",
+			10,
+			[]string{"\x02bold text", "\x02here", "done"},
+		},
+		{
+			"\x034,2red words\x03",
+			9,
+			[]string{"\x0304,02red", "\x0304,02wor", "\x0304,02ds"},
+		},
+
+		// A comma and digits after a restored colour must not be read as a
+		// background colour.
+		{
+			"\x0304aaaa ,12 bb",
+			9,
+			[]string{"\x0304aaaa", "\x0304\x02\x02,12", "\x0304bb"},
+		},
+		{
+			"\x0304,12aaaa ,12 bb",
+			10,
+			[]string{"\x0304,12aaaa", "\x0304,12,12", "\x0304,12bb"},
+		},
+
+		// Digits after colours end must not be read as a colour.
+		{
+			"\x02\x034a\x03\x02\x021",
+			100,
+			[]string{"\x02\x0304a\x03\x02\x021"},
+		},
+		{"\x034a\x03,1", 100, []string{"\x0304a\x0f,1"}},
+
+		// A background without a foreground uses the default foreground.
+		{"\x0304,12x\x0399y", 100, []string{"\x0304,12x\x0399,12y"}},
+		{"\x0304,12x\x0399 yy", 8, []string{"\x0304,12x", "\x0399,12yy"}},
+
+		// Never split inside a UTF-8 character.
+		{"héllo", 3, []string{"hé", "llo"}},
+	}
+
+	for _, test := range tests {
+		got := Split(test.input, test.maxBytes)
+
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("Split(%q, %d) = %q, wanted %q", test.input, test.maxBytes,
+				got, test.output)
+		}
+	}
+}
+
+// TestSplitKeepsText checks that splitting random formatted text does not
+// lose any of the text, such as by it being read as part of a code.
+func TestSplitKeepsText(t *testing.T) {
+	pieces := []string{"\x02", "\x1d", "\x0f", "\x03", "\x034", "\x0304,12",
+		"\x0399", "\x0399,5", "\x04FF0000", "\x04FF0000,00FF00", "1", "12", ",",
+		",3", "a", "b"}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var b strings.Builder
+		for j := r.Intn(12); j >= 0; j-- {
+			b.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		input := b.String()
+
+		got := Split(input, 1000)
+		if Strip(strings.Join(got, "")) != Strip(input) {
+			t.Errorf("Split(%q) = %q, which strips to %q, wanted %q", input, got,
+				Strip(strings.Join(got, "")), Strip(input))
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package format
+
+import "strings"
+
+// MarkdownOptions controls how FromMarkdown converts text.
+//
+// The zero value converts without adding any colour.
+type MarkdownOptions struct {
+	// CodeColour, if set, is the foreground colour for code spans.
+	CodeColour Colour
+
+	// LinkColour, if set, is the foreground colour for link URLs.
+	LinkColour Colour
+}
+
+// FromMarkdown converts a small subset of Markdown to IRC formatted text.
+//
+// It understands:
+//
+//	**bold** and __bold__
+//	*italic* and _italic_
+//	~~strikethrough~~
+//	`code` (shown as monospace)
+//	[text](url) (shown as "text (url)")
+//	Backslash escapes of punctuation, such as \*
+//
+// Anything else is left as is. Delimiters without a matching closing
+// delimiter are kept as literal text, as are underscores inside words (as in
+// snake_case).
+//
+// The result may be longer than a single IRC line permits. Use Split to break
+// it into lines.
+func FromMarkdown(text string, opts MarkdownOptions) string {
+	var b strings.Builder
+	convertMarkdown(&b, text, opts)
+	return b.String()
+}
+
+// emphasis maps Markdown delimiters to the code they toggle. Longer delimiters
+// come first so we try them before their prefixes.
+var emphasis = []struct {
+	delim string
+	code  byte
+}{
+	{"**", CodeBold},
+	{"__", CodeBold},
+	{"~~", CodeStrikethrough},
+	{"*", CodeItalic},
+	{"_", CodeItalic},
+}
+
+func convertMarkdown(b *strings.Builder, text string, opts MarkdownOptions) {
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		if c == '\\' && i+1 < len(text) && isPunct(text[i+1]) {
+			b.WriteByte(text[i+1])
+			i += 2
+			continue
+		}
+
+		if c == '`' {
+			if n := convertCode(b, text, i, opts); n > 0 {
+				i += n
+				continue
+			}
+		}
+
+		if c == '[' {
+			if n := convertLink(b, text, i, opts); n > 0 {
+				i += n
+				continue
+			}
+		}
+
+		if c == '*' || c == '_' || c == '~' {
+			if n := convertEmphasis(b, text, i, opts); n > 0 {
+				i += n
+				continue
+			}
+
+			// Write out the whole run of delimiter characters. Otherwise we could
+			// match the second * of a lone ** as an italic opener.
+			j := i
+			for j < len(text) && text[j] == c {
+				j++
+			}
+			b.WriteString(text[i:j])
+			i = j
+			continue
+		}
+
+		b.WriteByte(c)
+		i++
+	}
+}
+
+// convertEmphasis tries to convert an emphasis span starting at index. If
+// there is one we write it and return the number of bytes it took up.
+// Otherwise we return 0.
+func convertEmphasis(b *strings.Builder, text string, index int,
+	opts MarkdownOptions) int {
+	for _, e := range emphasis {
+		if !strings.HasPrefix(text[index:], e.delim) {
+			continue
+		}
+
+		// An opening delimiter must be followed by something other than space.
+		start := index + len(e.delim)
+		if start >= len(text) || text[start] == ' ' {
+			continue
+		}
+
+		// Underscores only count at word boundaries.
+		if e.delim[0] == '_' && index > 0 && isWordByte(text[index-1]) {
+			continue
+		}
+
+		// Start looking after the first character so the content is not empty.
+		end := findCloser(text, start+1, e.delim)
+		if end == -1 {
+			continue
+		}
+
+		b.WriteByte(e.code)
+		convertMarkdown(b, text[start:end], opts)
+		b.WriteByte(e.code)
+		return end + len(e.delim) - index
+	}
+
+	return 0
+}
+
+// findCloser finds the closing delimiter for an emphasis span whose content
+// starts at index. It returns -1 if there is none.
+func findCloser(text string, index int, delim string) int {
+	for i := index; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+
+		// Skip over code spans. Delimiters inside them do not count.
+		if text[i] == '`' {
+			if end := strings.IndexByte(text[i+1:], '`'); end != -1 {
+				i += end + 1
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(text[i:], delim) {
+			continue
+		}
+
+		// A single delimiter must not be part of a double one. For example the
+		// *s around b in "*a **b** c*".
+		if len(delim) == 1 {
+			run := 1
+			for i+run < len(text) && text[i+run] == delim[0] {
+				run++
+			}
+			if run > 1 {
+				i += run - 1
+				continue
+			}
+		}
+
+		// The closing delimiter must not be preceded by a space.
+		if text[i-1] == ' ' {
+			continue
+		}
+
+		after := i + len(delim)
+
+		if delim[0] == '_' && after < len(text) && isWordByte(text[after]) {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// convertCode tries to convert a code span starting at index. It returns the
+// number of bytes it took up or 0 if there is no code span.
+func convertCode(b *strings.Builder, text string, index int,
+	opts MarkdownOptions) int {
+	ticks := 0
+	for index+ticks < len(text) && text[index+ticks] == '`' {
+		ticks++
+	}
+	delim := text[index : index+ticks]
+
+	start := index + ticks
+	end := strings.Index(text[start:], delim)
+	if end == -1 {
+		return 0
+	}
+	code := text[start : start+end]
+	if code == "" {
+		return 0
+	}
+
+	// As in Markdown, a single surrounding space is removed so that code
+	// containing backticks can be written.
+	if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+		code = code[1 : len(code)-1]
+	}
+
+	writeColoured(b, opts.CodeColour, string(CodeMonospace)+code+
+		string(CodeMonospace), text[start+end+ticks:])
+	return start + end + ticks - index
+}
+
+// convertLink tries to convert a link starting at index. It returns the
+// number of bytes it took up or 0 if there is no link.
+func convertLink(b *strings.Builder, text string, index int,
+	opts MarkdownOptions) int {
+	closeText := strings.Index(text[index:], "](")
+	if closeText == -1 {
+		return 0
+	}
+	closeText += index
+
+	closeURL := strings.IndexByte(text[closeText+2:], ')')
+	if closeURL == -1 {
+		return 0
+	}
+	closeURL += closeText + 2
+
+	label := text[index+1 : closeText]
+	url := text[closeText+2 : closeURL]
+	if url == "" || strings.ContainsAny(url, " \n") {
+		return 0
+	}
+
+	if label == "" || label == url {
+		writeColoured(b, opts.LinkColour, url, text[closeURL+1:])
+	} else {
+		convertMarkdown(b, label, opts)
+		b.WriteString(" (")
+		writeColoured(b, opts.LinkColour, url, ")")
+		b.WriteString(")")
+	}
+
+	return closeURL + 1 - index
+}
+
+// writeColoured writes the text in the given foreground colour. If the colour
+// is not set we write the text as is. next is the text that will follow, so
+// that we can keep the code ending the colour from taking it in.
+func writeColoured(b *strings.Builder, c Colour, text, next string) {
+	if !c.Set {
+		b.WriteString(text)
+		return
+	}
+
+	b.WriteString(colourCodes(c, Colour{}))
+	b.WriteString(colourSeparator(c, Colour{}, text))
+	b.WriteString(text)
+	b.WriteByte(CodeColour)
+	b.WriteString(colourSeparator(Colour{}, Colour{}, next))
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+func isWordByte(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		c >= 0x80
+}
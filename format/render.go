@@ -0,0 +1,216 @@
+package format
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// colour describes one of the palette colours.
+type colour struct {
+	// rgb is the colour's usual RGB value.
+	rgb uint32
+
+	// ansi is the closest xterm 256 colour.
+	ansi int
+}
+
+// palette holds the standard 16 colours followed by the 83 extended colours
+// (16-98). Code 99 is the default colour and so is not here.
+var palette = []colour{
+	{0xffffff, 15}, {0x000000, 0}, {0x00007f, 4}, {0x009300, 2},
+	{0xff0000, 9}, {0x7f0000, 1}, {0x9c009c, 5}, {0xfc7f00, 208},
+	{0xffff00, 11}, {0x00fc00, 10}, {0x009393, 6}, {0x00ffff, 14},
+	{0x0000fc, 12}, {0xff00ff, 13}, {0x7f7f7f, 8}, {0xd2d2d2, 7},
+
+	{0x470000, 52}, {0x472100, 94}, {0x474700, 100}, {0x324700, 58},
+	{0x004700, 22}, {0x00472c, 29}, {0x004747, 23}, {0x002747, 24},
+	{0x000047, 17}, {0x2e0047, 54}, {0x470047, 53}, {0x47002a, 89},
+
+	{0x740000, 88}, {0x743a00, 130}, {0x747400, 142}, {0x517400, 64},
+	{0x007400, 28}, {0x007449, 35}, {0x007474, 30}, {0x004074, 25},
+	{0x000074, 18}, {0x4b0074, 91}, {0x740074, 90}, {0x740045, 125},
+
+	{0xb50000, 124}, {0xb56300, 166}, {0xb5b500, 184}, {0x7db500, 106},
+	{0x00b500, 34}, {0x00b571, 49}, {0x00b5b5, 37}, {0x0063b5, 33},
+	{0x0000b5, 19}, {0x7500b5, 129}, {0xb500b5, 127}, {0xb5006b, 161},
+
+	{0xff0000, 196}, {0xff8c00, 208}, {0xffff00, 226}, {0xb2ff00, 154},
+	{0x00ff00, 46}, {0x00ffa0, 86}, {0x00ffff, 51}, {0x008cff, 75},
+	{0x0000ff, 21}, {0xa500ff, 171}, {0xff00ff, 201}, {0xff0098, 198},
+
+	{0xff5959, 203}, {0xffb459, 215}, {0xffff71, 227}, {0xcfff60, 191},
+	{0x6fff6f, 83}, {0x65ffc9, 122}, {0x6dffff, 87}, {0x59b4ff, 111},
+	{0x5959ff, 63}, {0xc459ff, 177}, {0xff66ff, 207}, {0xff59bc, 205},
+
+	{0xff9c9c, 217}, {0xffd39c, 223}, {0xffff9c, 229}, {0xe2ff9c, 193},
+	{0x9cff9c, 157}, {0x9cffdb, 158}, {0x9cffff, 159}, {0x9cd3ff, 153},
+	{0x9c9cff, 147}, {0xdc9cff, 183}, {0xff9cff, 219}, {0xff94d3, 212},
+
+	{0x000000, 16}, {0x131313, 233}, {0x282828, 235}, {0x363636, 237},
+	{0x4d4d4d, 239}, {0x656565, 241}, {0x818181, 244}, {0x9f9f9f, 247},
+	{0xbcbcbc, 250}, {0xe2e2e2, 254}, {0xffffff, 231},
+}
+
+// ANSI renders formatted text using ANSI terminal escape sequences (SGR).
+//
+// Palette colours use xterm 256 colour sequences and hex colours use 24 bit
+// colour sequences. If the text contains any formatting, the result ends with
+// a reset sequence so formatting does not leak into whatever follows.
+//
+// This does not sanitize the text. If the text may contain terminal escape
+// sequences of its own, sanitize it first.
+func ANSI(text string) string {
+	var b strings.Builder
+	styled := false
+
+	for _, span := range Parse(text) {
+		if span.Style.IsZero() {
+			if styled {
+				b.WriteString("\x1b[0m")
+				styled = false
+			}
+			b.WriteString(span.Text)
+			continue
+		}
+
+		b.WriteString("\x1b[0")
+		b.WriteString(ansiCodes(span.Style))
+		b.WriteString("m")
+		b.WriteString(span.Text)
+		styled = true
+	}
+
+	if styled {
+		b.WriteString("\x1b[0m")
+	}
+
+	return b.String()
+}
+
+// ansiCodes returns the SGR parameters for the style. Each is prefixed with
+// ';'.
+func ansiCodes(style Style) string {
+	var codes []string
+
+	if style.Bold {
+		codes = append(codes, "1")
+	}
+	if style.Italic {
+		codes = append(codes, "3")
+	}
+	if style.Underline {
+		codes = append(codes, "4")
+	}
+	if style.Reverse {
+		codes = append(codes, "7")
+	}
+	if style.Strikethrough {
+		codes = append(codes, "9")
+	}
+	// Terminals are already monospace so there is nothing to do for it.
+
+	if c := ansiColour(style.Foreground, 38); c != "" {
+		codes = append(codes, c)
+	}
+	if c := ansiColour(style.Background, 48); c != "" {
+		codes = append(codes, c)
+	}
+
+	if len(codes) == 0 {
+		return ""
+	}
+	return ";" + strings.Join(codes, ";")
+}
+
+// ansiColour returns the SGR parameters to set the colour. base is 38 for
+// foreground and 48 for background.
+func ansiColour(c Colour, base int) string {
+	if !c.Set {
+		return ""
+	}
+
+	if c.Hex {
+		return fmt.Sprintf("%d;2;%d;%d;%d", base, c.RGB>>16&0xff, c.RGB>>8&0xff,
+			c.RGB&0xff)
+	}
+
+	if c.Code < 0 || c.Code >= len(palette) {
+		return ""
+	}
+
+	return strconv.Itoa(base) + ";5;" + strconv.Itoa(palette[c.Code].ansi)
+}
+
+// HTML renders formatted text as HTML.
+//
+// All text is escaped. Formatted spans are wrapped in <span> elements with
+// inline styles. Reverse is shown by swapping the foreground and background
+// colours, using black on white where a colour is not set.
+func HTML(text string) string {
+	var b strings.Builder
+
+	for _, span := range Parse(text) {
+		css := cssStyle(span.Style)
+		if css == "" {
+			b.WriteString(html.EscapeString(span.Text))
+			continue
+		}
+
+		b.WriteString(`<span style="`)
+		b.WriteString(css)
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(span.Text))
+		b.WriteString("</span>")
+	}
+
+	return b.String()
+}
+
+// cssStyle returns the inline CSS for the style.
+func cssStyle(style Style) string {
+	var props []string
+
+	if style.Bold {
+		props = append(props, "font-weight:bold")
+	}
+	if style.Italic {
+		props = append(props, "font-style:italic")
+	}
+
+	var decorations []string
+	if style.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if style.Strikethrough {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		props = append(props, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	if style.Monospace {
+		props = append(props, "font-family:monospace")
+	}
+
+	fg, bg := style.Foreground, style.Background
+	if style.Reverse {
+		if !fg.Set {
+			fg = PaletteColour(1)
+		}
+		if !bg.Set {
+			bg = PaletteColour(0)
+		}
+		fg, bg = bg, fg
+	}
+
+	if rgb, ok := fg.Value(); ok {
+		props = append(props, fmt.Sprintf("color:#%06x", rgb))
+	}
+	if rgb, ok := bg.Value(); ok {
+		props = append(props, fmt.Sprintf("background-color:#%06x", rgb))
+	}
+
+	return strings.Join(props, ";")
+}
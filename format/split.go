@@ -0,0 +1,219 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes returns the formatting codes that switch unformatted text to this
+// style.
+func (s Style) Codes() string {
+	return transition(Style{}, s)
+}
+
+// transition returns the formatting codes needed to go from one style to
+// another.
+func transition(from, to Style) string {
+	if from == to {
+		return ""
+	}
+
+	if to.IsZero() {
+		return string(CodeReset)
+	}
+
+	var b strings.Builder
+
+	toggles := []struct {
+		from, to bool
+		code     byte
+	}{
+		{from.Bold, to.Bold, CodeBold},
+		{from.Italic, to.Italic, CodeItalic},
+		{from.Underline, to.Underline, CodeUnderline},
+		{from.Strikethrough, to.Strikethrough, CodeStrikethrough},
+		{from.Monospace, to.Monospace, CodeMonospace},
+		{from.Reverse, to.Reverse, CodeReverse},
+	}
+	for _, t := range toggles {
+		if t.from != t.to {
+			b.WriteByte(t.code)
+		}
+	}
+
+	if from.Foreground != to.Foreground || from.Background != to.Background {
+		codes := colourCodes(to.Foreground, to.Background)
+
+		// It is not possible to unset only the background, so reset colours first
+		// if that is what we need.
+		if codes == "" || (from.Background.Set && !to.Background.Set) {
+			b.WriteByte(CodeColour)
+		}
+		b.WriteString(codes)
+	}
+
+	return b.String()
+}
+
+// colourCodes returns the codes to set the given colours. Both colours must
+// be palette colours or both hex colours to set them with one code. If they
+// are not, we can't set the background.
+//
+// Setting a background requires setting a foreground. If only a palette
+// background is set we use the default foreground colour, 99. There is no
+// such colour for hex codes, so if only a hex background is set we can't do
+// anything.
+func colourCodes(fg, bg Colour) string {
+	if !fg.Set {
+		if bg.Set && !bg.Hex {
+			return fmt.Sprintf("%c%02d,%02d", CodeColour, DefaultColour, bg.Code)
+		}
+		return ""
+	}
+
+	if fg.Hex {
+		s := fmt.Sprintf("%c%06X", CodeHexColour, fg.RGB)
+		if bg.Set && bg.Hex {
+			s += fmt.Sprintf(",%06X", bg.RGB)
+		}
+		return s
+	}
+
+	// Always use two digits so following text that starts with a digit is not
+	// taken as part of the code.
+	s := fmt.Sprintf("%c%02d", CodeColour, fg.Code)
+	if bg.Set && !bg.Hex {
+		s += fmt.Sprintf(",%02d", bg.Code)
+	}
+	return s
+}
+
+// colourSeparator returns what to write between the codes for the given
+// colours and the text that follows them.
+//
+// The codes could otherwise take in the start of the text. If we can't set
+// the colours we write a bare colour code to reset them, and digits after it
+// would be read as a colour. If the codes do not set a background, a comma
+// and digits would be read as one. We separate them with a pair of bold
+// codes, which has no visible effect.
+func colourSeparator(fg, bg Colour, text string) string {
+	if text == "" {
+		return ""
+	}
+
+	separate := false
+	switch {
+	case colourCodes(fg, bg) == "":
+		separate = isDigit(text[0])
+	case bg.Set && bg.Hex == fg.Hex:
+	default:
+		separate = text[0] == ','
+	}
+
+	if !separate {
+		return ""
+	}
+	return string([]byte{CodeBold, CodeBold})
+}
+
+// styledRune is a single character along with the style it is shown in.
+type styledRune struct {
+	text  string
+	style Style
+}
+
+// Split breaks formatted text into lines of at most maxBytes bytes each. It is
+// intended for breaking up text to send in multiple messages, such as when
+// the text will not fit in a single PRIVMSG.
+//
+// Each line starts with the codes needed to restore the formatting in effect
+// where the previous line ended. This is because clients reset formatting at
+// the end of every message. We never split inside a formatting code or a
+// UTF-8 character.
+//
+// We break at spaces where possible and drop the space we break at. Newlines
+// always start a new line. We only exceed maxBytes if it is too small to hold a
+// single character along with its formatting codes.
+func Split(text string, maxBytes int) []string {
+	var lines []string
+	var line []styledRune
+
+	for _, r := range styledRunes(text) {
+		if r.text == "\n" {
+			lines = append(lines, renderLine(line))
+			line = nil
+			continue
+		}
+
+		line = append(line, r)
+		if len(renderLine(line)) <= maxBytes || len(line) == 1 {
+			continue
+		}
+
+		// The line is too long. Break at the last space if there is one.
+		// Otherwise break before the character we just added.
+		breakAt := -1
+		for i := len(line) - 1; i > 0; i-- {
+			if line[i].text == " " {
+				breakAt = i
+				break
+			}
+		}
+
+		if breakAt == -1 {
+			lines = append(lines, renderLine(line[:len(line)-1]))
+			line = []styledRune{r}
+			continue
+		}
+
+		lines = append(lines, renderLine(line[:breakAt]))
+		line = append([]styledRune(nil), line[breakAt+1:]...)
+
+		// Restoring formatting at the start of the new line may mean what we
+		// carried over is still too long.
+		if len(line) > 1 && len(renderLine(line)) > maxBytes {
+			lines = append(lines, renderLine(line[:len(line)-1]))
+			line = []styledRune{r}
+		}
+	}
+
+	if len(line) > 0 {
+		lines = append(lines, renderLine(line))
+	}
+
+	return lines
+}
+
+// styledRunes breaks the text into characters and the style of each.
+func styledRunes(text string) []styledRune {
+	var runes []styledRune
+	for _, span := range Parse(text) {
+		for i := 0; i < len(span.Text); {
+			_, size := utf8.DecodeRuneInString(span.Text[i:])
+			runes = append(runes, styledRune{
+				text:  span.Text[i : i+size],
+				style: span.Style,
+			})
+			i += size
+		}
+	}
+	return runes
+}
+
+// renderLine turns styled characters back into formatted text.
+func renderLine(line []styledRune) string {
+	var b strings.Builder
+	style := Style{}
+	for _, r := range line {
+		b.WriteString(transition(style, r.style))
+		if style.Foreground != r.style.Foreground ||
+			style.Background != r.style.Background {
+			b.WriteString(colourSeparator(r.style.Foreground, r.style.Background,
+				r.text))
+		}
+		b.WriteString(r.text)
+		style = r.style
+	}
+	return b.String()
+}
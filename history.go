@@ -0,0 +1,383 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryStore stores messages for CHATHISTORY.
+//
+// Targets are channels or, for private messages, whatever name the server
+// files the conversation under. Targets are compared case insensitively.
+//
+// Implementations must be safe for concurrent use.
+type HistoryStore interface {
+	// Append stores a message. The message must have the msgid and time
+	// tags. Messages for a target must be appended in time order.
+	Append(target string, m Message) error
+
+	// Query returns the messages matching the query, oldest first. The query
+	// must not be TARGETS.
+	Query(q HistoryQuery) ([]Message, error)
+
+	// Targets returns the targets whose latest message is between the
+	// query's two times, along with the time of that message. They are in
+	// order of that time, going from the first time toward the second.
+	Targets(q HistoryQuery) ([]HistoryTarget, error)
+}
+
+// ErrMissingHistoryTags is the error Append returns if a message lacks a
+// msgid or time tag.
+var ErrMissingHistoryTags = errors.New("message must have msgid and time tags")
+
+// historyTime returns the time of a message to store.
+func historyTime(m Message) (time.Time, error) {
+	t, ok := m.ServerTime()
+	if !ok || m.MsgID() == "" {
+		return time.Time{}, ErrMissingHistoryTags
+	}
+	return t, nil
+}
+
+// historyIndex is a target's messages in time order. The stores implement it
+// so they can share the logic of selecting messages.
+type historyIndex interface {
+	Len() int
+
+	// Time returns the time of the message at the index.
+	Time(i int) time.Time
+
+	// Find returns the index of the message with the ID. If there is no such
+	// message it returns -1.
+	Find(msgID string) int
+}
+
+// selectHistory works out which messages a query selects. It returns the
+// range of indexes [from, to).
+//
+// If a selector refers to a message we don't have, we select nothing.
+func selectHistory(idx historyIndex, q HistoryQuery) (int, int) {
+	n := idx.Len()
+
+	// before returns the end of the messages before the selector. after
+	// returns the start of the messages after it.
+	before := func(s HistorySelector) int {
+		if s.MsgID != "" {
+			return idx.Find(s.MsgID)
+		}
+		return sort.Search(n, func(i int) bool { return !idx.Time(i).Before(s.Time) })
+	}
+	after := func(s HistorySelector) int {
+		if s.MsgID != "" {
+			i := idx.Find(s.MsgID)
+			if i == -1 {
+				return -1
+			}
+			return i + 1
+		}
+		return sort.Search(n, func(i int) bool { return idx.Time(i).After(s.Time) })
+	}
+
+	switch q.Subcommand {
+	case HistoryLatest:
+		start := 0
+		if !q.Start.IsZero() {
+			start = after(q.Start)
+			if start == -1 {
+				return 0, 0
+			}
+		}
+		return maxInt(start, n-q.Limit), n
+	case HistoryBefore:
+		end := before(q.Start)
+		if end == -1 {
+			return 0, 0
+		}
+		return maxInt(0, end-q.Limit), end
+	case HistoryAfter:
+		start := after(q.Start)
+		if start == -1 {
+			return 0, 0
+		}
+		return start, minInt(n, start+q.Limit)
+	case HistoryAround:
+		center := before(q.Start)
+		if center == -1 {
+			return 0, 0
+		}
+		start := maxInt(0, center-q.Limit/2)
+		end := minInt(n, start+q.Limit)
+		return maxInt(0, end-q.Limit), end
+	case HistoryBetween:
+		// The selectors may be in either order. We take the messages closest to
+		// the first.
+		if historySelectorTime(idx, q.Start).After(
+			historySelectorTime(idx, q.End)) {
+			end := before(q.Start)
+			start := after(q.End)
+			if end == -1 || start == -1 || start >= end {
+				return 0, 0
+			}
+			return maxInt(start, end-q.Limit), end
+		}
+
+		start := after(q.Start)
+		end := before(q.End)
+		if end == -1 || start == -1 || start >= end {
+			return 0, 0
+		}
+		return start, minInt(end, start+q.Limit)
+	default:
+		return 0, 0
+	}
+}
+
+// historySelectorTime returns the time a selector refers to.
+func historySelectorTime(idx historyIndex, s HistorySelector) time.Time {
+	if s.MsgID == "" {
+		return s.Time
+	}
+	if i := idx.Find(s.MsgID); i != -1 {
+		return idx.Time(i)
+	}
+	return time.Time{}
+}
+
+// selectTargets filters and orders targets for a TARGETS query. latest maps
+// each target to the time of its latest message.
+func selectTargets(latest map[string]HistoryTarget,
+	q HistoryQuery) []HistoryTarget {
+	start, end := q.Start.Time, q.End.Time
+	descending := start.After(end)
+	if descending {
+		start, end = end, start
+	}
+
+	var targets []HistoryTarget
+	for _, target := range latest {
+		if target.Latest.After(start) && target.Latest.Before(end) {
+			targets = append(targets, target)
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if descending {
+			return targets[i].Latest.After(targets[j].Latest)
+		}
+		return targets[i].Latest.Before(targets[j].Latest)
+	})
+
+	if q.Limit > 0 && len(targets) > q.Limit {
+		targets = targets[:q.Limit]
+	}
+	return targets
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ParseHistoryQuery parses a CHATHISTORY command from a client.
+func ParseHistoryQuery(m Message) (HistoryQuery, error) {
+	if m.Command != "CHATHISTORY" {
+		return HistoryQuery{}, fmt.Errorf("not a CHATHISTORY command: %s",
+			m.Command)
+	}
+	if len(m.Params) == 0 {
+		return HistoryQuery{}, fmt.Errorf("missing subcommand")
+	}
+
+	q := HistoryQuery{Subcommand: strings.ToUpper(m.Params[0])}
+
+	// The number of parameters after the subcommand, including the limit.
+	var want int
+	switch q.Subcommand {
+	case HistoryLatest, HistoryBefore, HistoryAfter, HistoryAround:
+		want = 3
+	case HistoryBetween:
+		want = 4
+	case HistoryTargets:
+		want = 3
+	default:
+		return HistoryQuery{}, fmt.Errorf("unknown subcommand: %s", q.Subcommand)
+	}
+	if len(m.Params)-1 < want {
+		return HistoryQuery{}, errHistoryNeedMoreParams
+	}
+	params := m.Params[1 : want+1]
+
+	limit, err := strconv.Atoi(params[len(params)-1])
+	if err != nil || limit < 1 {
+		return HistoryQuery{}, fmt.Errorf("invalid limit: %s",
+			params[len(params)-1])
+	}
+	q.Limit = limit
+
+	selectors := params[1 : len(params)-1]
+	if q.Subcommand == HistoryTargets {
+		selectors = params[:2]
+	} else {
+		q.Target = params[0]
+	}
+
+	q.Start, err = ParseHistorySelector(selectors[0])
+	if err != nil {
+		return HistoryQuery{}, err
+	}
+	if len(selectors) > 1 {
+		q.End, err = ParseHistorySelector(selectors[1])
+		if err != nil {
+			return HistoryQuery{}, err
+		}
+	}
+
+	// Only LATEST permits *.
+	if q.Subcommand != HistoryLatest &&
+		(q.Start.IsZero() || (len(selectors) > 1 && q.End.IsZero())) {
+		return HistoryQuery{}, fmt.Errorf("a selector is required")
+	}
+	if q.Subcommand == HistoryTargets &&
+		(q.Start.Time.IsZero() || q.End.Time.IsZero()) {
+		return HistoryQuery{}, fmt.Errorf("TARGETS requires timestamps")
+	}
+
+	return q, nil
+}
+
+var errHistoryNeedMoreParams = errors.New("not enough parameters")
+
+// HistoryResponder answers CHATHISTORY commands from a HistoryStore.
+type HistoryResponder struct {
+	Store HistoryStore
+
+	// ServerName is the prefix of replies.
+	ServerName string
+
+	// MaxLimit is the most messages we return. It is what we advertise in the
+	// CHATHISTORY ISUPPORT token. Zero means there is no limit.
+	MaxLimit int
+}
+
+// Respond answers a CHATHISTORY command. It returns the batch to send, or a
+// FAIL.
+//
+// allowed reports whether the client may see a target's history. It is
+// typically whether the client is in the channel. If it is nil, every target
+// is allowed.
+//
+// If the command has a label, the client expects a labeled response. We
+// label the batch or the FAIL.
+func (r *HistoryResponder) Respond(m Message,
+	allowed func(target string) bool) []Message {
+	label := m.Label()
+
+	q, err := ParseHistoryQuery(m)
+	if err != nil {
+		code := "INVALID_PARAMS"
+		if errors.Is(err, errHistoryNeedMoreParams) {
+			code = "NEED_MORE_PARAMS"
+		}
+		if len(m.Params) == 0 {
+			return []Message{r.fail(label, "NEED_MORE_PARAMS", err.Error())}
+		}
+		return []Message{r.fail(label, code, err.Error(), m.Params[0])}
+	}
+
+	if r.MaxLimit > 0 && q.Limit > r.MaxLimit {
+		q.Limit = r.MaxLimit
+	}
+
+	var b *Batch
+	if q.Subcommand == HistoryTargets {
+		b, err = r.targets(q, allowed)
+	} else {
+		b, err = r.query(q, allowed)
+	}
+	if err != nil {
+		return []Message{r.fail(label, "MESSAGE_ERROR",
+			"Messages could not be retrieved", q.Subcommand)}
+	}
+	if b == nil {
+		return []Message{r.fail(label, "INVALID_TARGET",
+			"Messages could not be retrieved", q.Subcommand, q.Target)}
+	}
+
+	if label != "" {
+		b.Start = b.Start.WithLabel(label)
+	}
+	return b.Flatten()
+}
+
+// query creates the batch for a query other than TARGETS. If the client may
+// not see the target we return nil.
+func (r *HistoryResponder) query(q HistoryQuery,
+	allowed func(string) bool) (*Batch, error) {
+	if allowed != nil && !allowed(q.Target) {
+		return nil, nil
+	}
+
+	msgs, err := r.Store.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBatch("", BatchChatHistory, q.Target)
+	b.Start.Prefix = r.ServerName
+	b.Messages = msgs
+	return b, nil
+}
+
+// targets creates the batch for a TARGETS query.
+func (r *HistoryResponder) targets(q HistoryQuery,
+	allowed func(string) bool) (*Batch, error) {
+	// Ask for everything since we filter.
+	all := q
+	all.Limit = 0
+	targets, err := r.Store.Targets(all)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBatch("", BatchChatHistoryTargets)
+	b.Start.Prefix = r.ServerName
+	for _, target := range targets {
+		if allowed != nil && !allowed(target.Target) {
+			continue
+		}
+		if len(b.Messages) == q.Limit {
+			break
+		}
+
+		b.Messages = append(b.Messages, Message{
+			Prefix:  r.ServerName,
+			Command: "CHATHISTORY",
+			Params: []string{HistoryTargets, target.Target,
+				FormatServerTime(target.Latest)},
+		})
+	}
+	return b, nil
+}
+
+func (r *HistoryResponder) fail(label, code, description string,
+	context ...string) Message {
+	m := NewFail("CHATHISTORY", code, description, context...).Message(
+		r.ServerName)
+	if label != "" {
+		m = m.WithLabel(label)
+	}
+	return m
+}
@@ -0,0 +1,317 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var historyBase = time.Date(2019, 1, 2, 3, 0, 0, 0, time.UTC)
+
+// historyAt returns the time of the nth message we store.
+func historyAt(n int) time.Time {
+	return historyBase.Add(time.Duration(n) * time.Minute)
+}
+
+// fillHistory stores m0 through m9 for #test and m10 for alice.
+func fillHistory(t *testing.T, store HistoryStore) {
+	for i := 0; i < 11; i++ {
+		target := "#test"
+		if i == 10 {
+			target = "alice"
+		}
+
+		m := Message{
+			Prefix:  "bob!b@h",
+			Command: "PRIVMSG",
+			Params:  []string{target, fmt.Sprintf("message %d", i)},
+		}.WithMsgID(fmt.Sprintf("m%d", i)).WithServerTime(historyAt(i))
+
+		if err := store.Append(target, m); err != nil {
+			t.Fatalf("Append() = %s", err)
+		}
+	}
+}
+
+func msgIDs(msgs []Message) []string {
+	var ids []string
+	for _, m := range msgs {
+		ids = append(ids, m.MsgID())
+	}
+	return ids
+}
+
+func testHistoryQueries(t *testing.T, name string, store HistoryStore) {
+	tests := []struct {
+		query HistoryQuery
+		want  []string
+	}{
+		{LatestQuery("#test", HistorySelector{}, 3), []string{"m7", "m8", "m9"}},
+		{LatestQuery("#TEST", HistorySelector{}, 3), []string{"m7", "m8", "m9"}},
+		{LatestQuery("#test", MsgIDSelector("m5"), 10),
+			[]string{"m6", "m7", "m8", "m9"}},
+		{LatestQuery("#test", MsgIDSelector("m5"), 2), []string{"m8", "m9"}},
+		{BeforeQuery("#test", MsgIDSelector("m5"), 2), []string{"m3", "m4"}},
+		{BeforeQuery("#test", TimeSelector(historyAt(5)), 2),
+			[]string{"m3", "m4"}},
+		{BeforeQuery("#test", MsgIDSelector("m1"), 5), []string{"m0"}},
+		{AfterQuery("#test", MsgIDSelector("m5"), 2), []string{"m6", "m7"}},
+		{AfterQuery("#test", TimeSelector(historyAt(5)), 2),
+			[]string{"m6", "m7"}},
+		{AroundQuery("#test", MsgIDSelector("m5"), 4),
+			[]string{"m3", "m4", "m5", "m6"}},
+		{AroundQuery("#test", MsgIDSelector("m9"), 4),
+			[]string{"m6", "m7", "m8", "m9"}},
+		{BetweenQuery("#test", MsgIDSelector("m2"), MsgIDSelector("m6"), 10),
+			[]string{"m3", "m4", "m5"}},
+		{BetweenQuery("#test", MsgIDSelector("m2"), MsgIDSelector("m6"), 2),
+			[]string{"m3", "m4"}},
+		{BetweenQuery("#test", MsgIDSelector("m6"), MsgIDSelector("m2"), 2),
+			[]string{"m4", "m5"}},
+		{BetweenQuery("#test", TimeSelector(historyAt(2)),
+			TimeSelector(historyAt(4)), 10), []string{"m3"}},
+		{BeforeQuery("#test", MsgIDSelector("unknown"), 10), nil},
+		{LatestQuery("#nowhere", HistorySelector{}, 10), nil},
+		{LatestQuery("alice", HistorySelector{}, 10), []string{"m10"}},
+	}
+
+	for _, test := range tests {
+		msgs, err := store.Query(test.query)
+		if err != nil {
+			t.Fatalf("%s: Query(%+v) = %s", name, test.query, err)
+		}
+
+		if got := msgIDs(msgs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Query(%+v) = %q, wanted %q", name, test.query, got,
+				test.want)
+		}
+	}
+
+	targets, err := store.Targets(TargetsQuery(historyBase.Add(-time.Minute),
+		historyAt(20), 0))
+	if err != nil {
+		t.Fatalf("%s: Targets() = %s", name, err)
+	}
+	want := []HistoryTarget{{"#test", historyAt(9)}, {"alice", historyAt(10)}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("%s: Targets() = %+v, wanted %+v", name, targets, want)
+	}
+
+	// Reversed times reverse the order.
+	targets, err = store.Targets(TargetsQuery(historyAt(20),
+		historyBase.Add(-time.Minute), 1))
+	if err != nil {
+		t.Fatalf("%s: Targets() = %s", name, err)
+	}
+	want = []HistoryTarget{{"alice", historyAt(10)}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("%s: Targets() = %+v, wanted %+v", name, targets, want)
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	store := NewMemoryHistory(100)
+	fillHistory(t, store)
+	testHistoryQueries(t, "memory", store)
+
+	if err := store.Append("#test", Message{Command: "PRIVMSG",
+		Params: []string{"#test", "hi"}}); err != ErrMissingHistoryTags {
+		t.Errorf("Append() without tags = %v, wanted ErrMissingHistoryTags", err)
+	}
+}
+
+func TestMemoryHistoryRing(t *testing.T) {
+	store := NewMemoryHistory(5)
+	fillHistory(t, store)
+
+	tests := []struct {
+		query HistoryQuery
+		want  []string
+	}{
+		{LatestQuery("#test", HistorySelector{}, 10),
+			[]string{"m5", "m6", "m7", "m8", "m9"}},
+		{BeforeQuery("#test", MsgIDSelector("m7"), 10), []string{"m5", "m6"}},
+		// m2 is gone.
+		{AfterQuery("#test", MsgIDSelector("m2"), 10), nil},
+		{AfterQuery("#test", TimeSelector(historyAt(2)), 10),
+			[]string{"m5", "m6", "m7", "m8", "m9"}},
+	}
+
+	for _, test := range tests {
+		msgs, err := store.Query(test.query)
+		if err != nil {
+			t.Fatalf("Query(%+v) = %s", test.query, err)
+		}
+
+		if got := msgIDs(msgs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Query(%+v) = %q, wanted %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	store, err := OpenFileHistory(path)
+	if err != nil {
+		t.Fatalf("OpenFileHistory() = %s", err)
+	}
+	fillHistory(t, store)
+	testHistoryQueries(t, "file", store)
+
+	msgs, err := store.Query(LatestQuery("#test", HistorySelector{}, 1))
+	if err != nil || len(msgs) != 1 || msgs[0].Params[1] != "message 9" ||
+		msgs[0].Prefix != "bob!b@h" {
+		t.Errorf("Query() = %v, %v", msgs, err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	// Simulate a crash partway through writing a line.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile() = %s", err)
+	}
+	if _, err := f.WriteString("#test @msgid=m11 PRIV"); err != nil {
+		t.Fatalf("WriteString() = %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	// The index is rebuilt when we reopen.
+	store, err = OpenFileHistory(path)
+	if err != nil {
+		t.Fatalf("OpenFileHistory() = %s", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	testHistoryQueries(t, "reopened file", store)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() = %s", err)
+	}
+	if strings.Contains(string(data), "m11") {
+		t.Errorf("partial line was not discarded")
+	}
+}
+
+func TestHistoryResponder(t *testing.T) {
+	store := NewMemoryHistory(100)
+	fillHistory(t, store)
+
+	r := &HistoryResponder{Store: store, ServerName: "irc", MaxLimit: 2}
+
+	allowed := func(target string) bool { return target != "#secret" }
+
+	tests := []struct {
+		input  string
+		output []string
+	}{
+		{
+			// The limit is lowered to MaxLimit.
+			"@label=abc CHATHISTORY LATEST #test * 50\r\n",
+			[]string{
+				"@label=abc :irc BATCH +REF chathistory #test\r\n",
+				"@batch=REF;msgid=m8;time=2019-01-02T03:08:00.000Z :bob!b@h PRIVMSG #test :message 8\r\n",
+				"@batch=REF;msgid=m9;time=2019-01-02T03:09:00.000Z :bob!b@h PRIVMSG #test :message 9\r\n",
+				":irc BATCH -REF\r\n",
+			},
+		},
+		{
+			"CHATHISTORY TARGETS timestamp=2019-01-01T00:00:00.000Z timestamp=2020-01-01T00:00:00.000Z 10\r\n",
+			[]string{
+				":irc BATCH +REF draft/chathistory-targets\r\n",
+				"@batch=REF :irc CHATHISTORY TARGETS #test 2019-01-02T03:09:00.000Z\r\n",
+				"@batch=REF :irc CHATHISTORY TARGETS alice 2019-01-02T03:10:00.000Z\r\n",
+				":irc BATCH -REF\r\n",
+			},
+		},
+		{
+			"CHATHISTORY LATEST #test\r\n",
+			[]string{":irc FAIL CHATHISTORY NEED_MORE_PARAMS LATEST :not enough parameters\r\n"},
+		},
+		{
+			"CHATHISTORY BEFORE #test * 10\r\n",
+			[]string{":irc FAIL CHATHISTORY INVALID_PARAMS BEFORE :a selector is required\r\n"},
+		},
+		{
+			"CHATHISTORY LATEST #secret * 10\r\n",
+			[]string{":irc FAIL CHATHISTORY INVALID_TARGET LATEST #secret :Messages could not be retrieved\r\n"},
+		},
+		// A FAIL carries the label too.
+		{
+			"@label=def CHATHISTORY LATEST #secret * 10\r\n",
+			[]string{"@label=def :irc FAIL CHATHISTORY INVALID_TARGET LATEST #secret :Messages could not be retrieved\r\n"},
+		},
+		{
+			"@label=ghi CHATHISTORY LATEST #test\r\n",
+			[]string{"@label=ghi :irc FAIL CHATHISTORY NEED_MORE_PARAMS LATEST :not enough parameters\r\n"},
+		},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		msgs := r.Respond(m, allowed)
+
+		var got []string
+		for _, reply := range msgs {
+			buf, err := reply.Encode()
+			if err != nil {
+				t.Fatalf("Encode(%s) = %s", reply, err)
+			}
+			got = append(got, buf)
+		}
+
+		// Batch references are random.
+		if len(msgs) > 0 && msgs[0].Command == "BATCH" {
+			ref := msgs[0].Params[0][1:]
+			for i := range got {
+				got[i] = strings.Replace(got[i], ref, "REF", -1)
+			}
+		}
+
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("Respond(%q) = %q, wanted %q", test.input, got, test.output)
+		}
+	}
+}
+
+func TestHistoryResponderLabeledFail(t *testing.T) {
+	r := &HistoryResponder{Store: NewMemoryHistory(10), ServerName: "irc"}
+	tracker := NewLabelTracker(time.Minute)
+
+	m, err := LatestQuery("#secret", HistorySelector{}, 10).Message(0)
+	if err != nil {
+		t.Fatalf("Message() = %s", err)
+	}
+	query, ch := tracker.Send(m)
+
+	for _, reply := range r.Respond(query, func(string) bool { return false }) {
+		if !tracker.Add(reply) {
+			t.Errorf("tracker did not take %s", reply)
+		}
+	}
+
+	select {
+	case resp := <-ch:
+		var fail *StandardReply
+		if !errors.As(resp.Err, &fail) || fail.Code != "INVALID_TARGET" {
+			t.Errorf("response error = %v, wanted INVALID_TARGET", resp.Err)
+		}
+	default:
+		t.Fatalf("no response for the label")
+	}
+}
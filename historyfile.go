@@ -0,0 +1,232 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileHistory is a HistoryStore that appends messages to a file.
+//
+// Each line of the file is a target, a space, and the encoded message. We
+// keep an index of each target's messages in memory: their times, IDs, and
+// where they are in the file. We build it when opening the file. Queries use
+// the index and read only the messages they return.
+type FileHistory struct {
+	mu      sync.RWMutex
+	file    *os.File
+	size    int64
+	targets map[string]*fileIndex
+}
+
+// fileIndex indexes a target's messages in the file.
+type fileIndex struct {
+	target  string
+	entries []fileEntry
+	ids     map[string]int
+}
+
+type fileEntry struct {
+	time   time.Time
+	offset int64
+	length int
+}
+
+// OpenFileHistory opens the history file, creating it if necessary.
+//
+// If the file ends with a partial line, such as after a crash while writing,
+// we discard it.
+func OpenFileHistory(path string) (*FileHistory, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history file: %s", err)
+	}
+
+	h := &FileHistory{
+		file:    file,
+		targets: map[string]*fileIndex{},
+	}
+
+	if err := h.load(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// load reads the file and builds the index.
+func (h *FileHistory) load() error {
+	reader := bufio.NewReader(h.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading history file: %s", err)
+		}
+
+		target, m, err := parseHistoryLine(line)
+		if err != nil {
+			return fmt.Errorf("invalid line in history file at offset %d: %s",
+				offset, err)
+		}
+
+		t, err := historyTime(m)
+		if err != nil {
+			return fmt.Errorf("invalid message in history file at offset %d: %s",
+				offset, err)
+		}
+
+		h.index(target, m.MsgID(), t, offset, len(line))
+		offset += int64(len(line))
+	}
+
+	if err := h.file.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating history file: %s", err)
+	}
+	h.size = offset
+	return nil
+}
+
+// parseHistoryLine parses a line from the file.
+func parseHistoryLine(line string) (string, Message, error) {
+	idx := strings.IndexByte(line, ' ')
+	if idx < 1 {
+		return "", Message{}, fmt.Errorf("missing target")
+	}
+
+	m, err := ParseMessage(strings.TrimSuffix(line[idx+1:], "\n") + "\r\n")
+	if err != nil {
+		return "", Message{}, err
+	}
+
+	return line[:idx], m, nil
+}
+
+func (h *FileHistory) index(target, msgID string, t time.Time, offset int64,
+	length int) {
+	key := foldName(target)
+	idx, ok := h.targets[key]
+	if !ok {
+		idx = &fileIndex{target: target, ids: map[string]int{}}
+		h.targets[key] = idx
+	}
+
+	idx.ids[msgID] = len(idx.entries)
+	idx.entries = append(idx.entries, fileEntry{
+		time:   t,
+		offset: offset,
+		length: length,
+	})
+}
+
+// Close closes the file.
+func (h *FileHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+// Append stores a message.
+func (h *FileHistory) Append(target string, m Message) error {
+	t, err := historyTime(m)
+	if err != nil {
+		return err
+	}
+
+	if target == "" || strings.ContainsAny(target, " \r\n") {
+		return fmt.Errorf("invalid target: %q", target)
+	}
+
+	buf, err := m.Encode()
+	if err != nil {
+		return fmt.Errorf("error encoding message: %s", err)
+	}
+	line := target + " " + strings.TrimSuffix(buf, "\r\n") + "\n"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.file.WriteAt([]byte(line), h.size); err != nil {
+		return fmt.Errorf("error writing history file: %s", err)
+	}
+
+	h.index(target, m.MsgID(), t, h.size, len(line))
+	h.size += int64(len(line))
+	return nil
+}
+
+// Len returns how many messages the target has.
+func (idx *fileIndex) Len() int {
+	return len(idx.entries)
+}
+
+// Time returns the time of the message at index i.
+func (idx *fileIndex) Time(i int) time.Time {
+	return idx.entries[i].time
+}
+
+// Find returns the index of the message with the ID, or -1.
+func (idx *fileIndex) Find(msgID string) int {
+	i, ok := idx.ids[msgID]
+	if !ok {
+		return -1
+	}
+	return i
+}
+
+// Query returns the messages matching the query, oldest first.
+func (h *FileHistory) Query(q HistoryQuery) ([]Message, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	idx, ok := h.targets[foldName(q.Target)]
+	if !ok {
+		return nil, nil
+	}
+
+	from, to := selectHistory(idx, q)
+
+	var msgs []Message
+	for i := from; i < to; i++ {
+		entry := idx.entries[i]
+
+		buf := make([]byte, entry.length)
+		if _, err := h.file.ReadAt(buf, entry.offset); err != nil {
+			return nil, fmt.Errorf("error reading history file: %s", err)
+		}
+
+		_, m, err := parseHistoryLine(string(buf))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line in history file at offset %d: %s",
+				entry.offset, err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// Targets returns the targets with their latest message between the query's
+// times.
+func (h *FileHistory) Targets(q HistoryQuery) ([]HistoryTarget, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	latest := map[string]HistoryTarget{}
+	for key, idx := range h.targets {
+		latest[key] = HistoryTarget{
+			Target: idx.target,
+			Latest: idx.entries[len(idx.entries)-1].time,
+		}
+	}
+
+	return selectTargets(latest, q), nil
+}
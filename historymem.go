@@ -0,0 +1,147 @@
+package irc
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryHistory is a HistoryStore that holds messages in memory. It keeps up
+// to a fixed number of messages for each target, discarding the oldest.
+type MemoryHistory struct {
+	size int
+
+	mu      sync.RWMutex
+	targets map[string]*historyRing
+}
+
+// historyRing is a ring buffer holding a target's latest messages.
+type historyRing struct {
+	target string
+
+	msgs  []Message
+	times []time.Time
+
+	// start is the position of the oldest message.
+	start int
+
+	// count is how many messages there are.
+	count int
+
+	// first is the sequence number of the oldest message. Each message gets
+	// the next number.
+	first uint64
+
+	// ids maps message IDs to sequence numbers.
+	ids map[string]uint64
+}
+
+// NewMemoryHistory creates a MemoryHistory holding up to size messages for
+// each target.
+func NewMemoryHistory(size int) *MemoryHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryHistory{
+		size:    size,
+		targets: map[string]*historyRing{},
+	}
+}
+
+// Append stores a message.
+func (h *MemoryHistory) Append(target string, m Message) error {
+	t, err := historyTime(m)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := foldName(target)
+	ring, ok := h.targets[key]
+	if !ok {
+		ring = &historyRing{
+			target: target,
+			msgs:   make([]Message, h.size),
+			times:  make([]time.Time, h.size),
+			ids:    map[string]uint64{},
+		}
+		h.targets[key] = ring
+	}
+
+	ring.add(m, t)
+	return nil
+}
+
+func (r *historyRing) add(m Message, t time.Time) {
+	if r.count == len(r.msgs) {
+		delete(r.ids, r.msgs[r.start].MsgID())
+		r.start = (r.start + 1) % len(r.msgs)
+		r.count--
+		r.first++
+	}
+
+	pos := (r.start + r.count) % len(r.msgs)
+	r.msgs[pos] = m
+	r.times[pos] = t
+	r.ids[m.MsgID()] = r.first + uint64(r.count)
+	r.count++
+}
+
+// Len returns how many messages there are.
+func (r *historyRing) Len() int {
+	return r.count
+}
+
+// Time returns the time of the message at index i, where 0 is the oldest.
+func (r *historyRing) Time(i int) time.Time {
+	return r.times[(r.start+i)%len(r.msgs)]
+}
+
+// Find returns the index of the message with the ID, or -1.
+func (r *historyRing) Find(msgID string) int {
+	seq, ok := r.ids[msgID]
+	if !ok {
+		return -1
+	}
+	return int(seq - r.first)
+}
+
+// Query returns the messages matching the query, oldest first.
+func (h *MemoryHistory) Query(q HistoryQuery) ([]Message, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ring, ok := h.targets[foldName(q.Target)]
+	if !ok {
+		return nil, nil
+	}
+
+	from, to := selectHistory(ring, q)
+
+	var msgs []Message
+	for i := from; i < to; i++ {
+		msgs = append(msgs, ring.msgs[(ring.start+i)%len(ring.msgs)])
+	}
+	return msgs, nil
+}
+
+// Targets returns the targets with their latest message between the query's
+// times.
+func (h *MemoryHistory) Targets(q HistoryQuery) ([]HistoryTarget, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	latest := map[string]HistoryTarget{}
+	for key, ring := range h.targets {
+		if ring.count == 0 {
+			continue
+		}
+		latest[key] = HistoryTarget{
+			Target: ring.target,
+			Latest: ring.Time(ring.count - 1),
+		}
+	}
+
+	return selectTargets(latest, q), nil
+}
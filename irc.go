@@ -8,26 +8,32 @@ import (
 
 const (
 	// MaxLineLength is the maximum protocol message line length. It includes
-	// CRLF.
+	// CRLF. It does not include tags.
 	MaxLineLength = 512
 
-	// ReplyWelcome is the RPL_WELCOME response numeric.
-	ReplyWelcome = "001"
-
-	// ReplyYoureOper is the RPL_YOUREOPER response numeric.
-	ReplyYoureOper = "381"
+	// MaxTagsLength is the maximum length of the tags portion of a message. It
+	// includes the leading '@' and the trailing space.
+	MaxTagsLength = 8191
 )
 
 // ErrTruncated is the error returned by Encode if the message gets truncated
 // due to encoding to more than MaxLineLength bytes.
 var ErrTruncated = errors.New("message truncated")
 
+// ErrInjection is the error returned by Encode if the message contains CR, LF,
+// or NUL.
+var ErrInjection = errors.New("message contains CR, LF, or NUL")
+
 // It is not always valid for there to be a parameter with zero characters. If
 // there is one, it should have a ':' prefix.
 var errEmptyParam = errors.New("parameter with zero characters")
 
 // Message holds a protocol message. See section 2.3.1 in RFC 1459/2812.
 type Message struct {
+	// Tags holds IRCv3 message tags. It may be nil. A tag without a value has
+	// an empty value. See https://ircv3.net/specs/extensions/message-tags.
+	Tags map[string]string
+
 	// Prefix may be blank. It's optional.
 	Prefix string
 
@@ -39,7 +45,32 @@ type Message struct {
 }
 
 func (m Message) String() string {
-	return fmt.Sprintf("Prefix [%s] Command [%s] Params%q", m.Prefix, m.Command,
+	return fmt.Sprintf("%sPrefix [%s] Command [%s] Params%q", m.tagsString(),
+		m.Prefix, m.Command, m.Params)
+}
+
+// tagsString describes the tags for String. If there are none it is blank.
+func (m Message) tagsString() string {
+	if len(m.Tags) == 0 {
+		return ""
+	}
+
+	var tags []string
+	for _, key := range sortedTagKeys(m.Tags) {
+		tags = append(tags, key+"="+m.Tags[key])
+	}
+	return fmt.Sprintf("Tags%q ", tags)
+}
+
+// SafeString is like String except the result is safe to write to a terminal
+// or log. The prefix and command are sanitized using SanitizeEscape. The tags
+// and params are quoted, which escapes anything unsafe in them.
+//
+// String does not sanitize the prefix, which may contain any character other
+// than NUL, CR, LF, and space.
+func (m Message) SafeString() string {
+	return fmt.Sprintf("%sPrefix [%s] Command [%s] Params%q", m.tagsString(),
+		Sanitize(m.Prefix, SanitizeEscape), Sanitize(m.Command, SanitizeEscape),
 		m.Params)
 }
 
@@ -52,3 +83,23 @@ func (m Message) SourceNick() string {
 	}
 	return m.Prefix[:idx]
 }
+
+// foldName lowercases a nick or channel name for comparison. It uses the
+// rfc1459 casemapping where []\~ are the uppercase forms of {}|^.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + 32
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '~':
+			return '^'
+		}
+		return r
+	}, name)
+}
@@ -1,6 +1,11 @@
 package irc
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestSourceNick(t *testing.T) {
 	tests := []struct {
@@ -708,3 +713,300 @@ func TestEncodeMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		input          string
+		mode           SanitizeMode
+		keepFormatting bool
+		output         string
+	}{
+		{"hi there", SanitizeEscape, false, "hi there"},
+		{"héllo 世界", SanitizeEscape, false, "héllo 世界"},
+		{"a\x1b[2Jb", SanitizeEscape, false, `a\x1b[2Jb`},
+		{"a\x1b[2Jb", SanitizeDrop, false, "a[2Jb"},
+		{"a\x1b[2Jb", SanitizeVisible, false, "a\u241b[2Jb"},
+		{"\x07\x7f", SanitizeVisible, false, "\u2407\u2421"},
+		{"x\u202ey", SanitizeEscape, false, `x\u202ey`},
+		{"x\u202ey", SanitizeDrop, false, "xy"},
+		{"x\u202ey", SanitizeVisible, false, "x<U+202E>y"},
+		{"x\u009by", SanitizeEscape, false, `x\x9by`},
+		{"x\xffy", SanitizeEscape, false, `x\xffy`},
+		{"x\xffy", SanitizeDrop, false, "xy"},
+		{"x\xffy", SanitizeVisible, false, "x\ufffdy"},
+		{"\x02bold\x02 \x034red", SanitizeDrop, false, "bold 4red"},
+		{"\x02bold\x02 \x1b\x034red", SanitizeDrop, true, "\x02bold\x02 \x034red"},
+	}
+
+	for _, test := range tests {
+		s := Sanitizer{Mode: test.mode, KeepFormatting: test.keepFormatting}
+		got := s.Sanitize(test.input)
+		if got != test.output {
+			t.Errorf("%+v.Sanitize(%q) = %q, wanted %q", s, test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestSafeString(t *testing.T) {
+	tests := []struct {
+		input  Message
+		output string
+	}{
+		{
+			Message{Prefix: "nick!u@h", Command: "PRIVMSG",
+				Params: []string{"#test", "hi"}},
+			`Prefix [nick!u@h] Command [PRIVMSG] Params["#test" "hi"]`,
+		},
+		{
+			Message{Prefix: "ni\x1b[31mck!u@h", Command: "PRIVMSG",
+				Params: []string{"#test", "\x1b]0;owned\x07\u202e"}},
+			`Prefix [ni\x1b[31mck!u@h] Command [PRIVMSG] ` +
+				`Params["#test" "\x1b]0;owned\a\u202e"]`,
+		},
+	}
+
+	for _, test := range tests {
+		got := test.input.SafeString()
+		if got != test.output {
+			t.Errorf("%q.SafeString() = %s, wanted %s", test.input.Prefix, got,
+				test.output)
+		}
+	}
+}
+
+func TestEncodeWithPolicy(t *testing.T) {
+	tests := []struct {
+		input     Message
+		policy    InjectionPolicy
+		output    string
+		injection bool
+		success   bool
+	}{
+		// Attempt to inject a second command via a parameter.
+		{
+			Message{Command: "PRIVMSG",
+				Params: []string{"#test", "hi\r\nJOIN #evil"}},
+			InjectionReject,
+			"",
+			true,
+			false,
+		},
+		{
+			Message{Command: "PRIVMSG",
+				Params: []string{"#test", "hi\r\nJOIN #evil"}},
+			InjectionStrip,
+			"PRIVMSG #test :hiJOIN #evil\r\n",
+			false,
+			true,
+		},
+		{
+			Message{Command: "PRIVMSG",
+				Params: []string{"#test", "hi\r\nJOIN #evil"}},
+			InjectionReplace,
+			"PRIVMSG #test :hi  JOIN #evil\r\n",
+			false,
+			true,
+		},
+
+		// A bare LF is enough for many servers.
+		{
+			Message{Command: "PRIVMSG",
+				Params: []string{"#test", "hi\nQUIT"}},
+			InjectionReject,
+			"",
+			true,
+			false,
+		},
+
+		// NUL terminates the line for some servers.
+		{
+			Message{Command: "PRIVMSG", Params: []string{"#test", "a\x00b"}},
+			InjectionReject,
+			"",
+			true,
+			false,
+		},
+
+		// Injection in a middle parameter.
+		{
+			Message{Command: "PRIVMSG", Params: []string{"#te\nst", "hi"}},
+			InjectionReject,
+			"",
+			true,
+			false,
+		},
+		{
+			Message{Command: "PRIVMSG", Params: []string{"#te\nst", "hi"}},
+			InjectionStrip,
+			"PRIVMSG #test hi\r\n",
+			false,
+			true,
+		},
+
+		// Injection in the prefix.
+		{
+			Message{Prefix: "nick\r\nQUIT", Command: "PRIVMSG",
+				Params: []string{"#test", "hi"}},
+			InjectionReject,
+			"",
+			true,
+			false,
+		},
+
+		// Sanitizing a middle parameter must not let a space through.
+		{
+			Message{Command: "MODE", Params: []string{"#test", "+o\nx", "nick"}},
+			InjectionReplace,
+			"",
+			false,
+			false,
+		},
+
+		// Injection in the command is never permitted.
+		{
+			Message{Command: "PRIVMSG\r\nQUIT", Params: []string{"#test", "hi"}},
+			InjectionStrip,
+			"",
+			false,
+			false,
+		},
+
+		// Commands must be letters or 3 digits.
+		{Message{Command: ""}, InjectionReject, "", false, false},
+		{Message{Command: "PRIV MSG"}, InjectionReject, "", false, false},
+		{Message{Command: "PRIVMSG0"}, InjectionReject, "", false, false},
+		{Message{Command: "01"}, InjectionReject, "", false, false},
+		{Message{Command: "0001"}, InjectionReject, "", false, false},
+		{Message{Command: "001"}, InjectionReject, "001\r\n", false, true},
+		{Message{Command: "privmsg"}, InjectionReject, "privmsg\r\n", false,
+			true},
+
+		// Prefix may not contain a space.
+		{Message{Prefix: "a b", Command: "PING"}, InjectionReject, "", false,
+			false},
+
+		// Middle parameters must not start with ':'.
+		{
+			Message{Command: "PRIVMSG", Params: []string{":#test", "hi"}},
+			InjectionReject,
+			"",
+			false,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		buf, err := test.input.EncodeWithPolicy(test.policy)
+		if err != nil {
+			if test.success {
+				t.Errorf("EncodeWithPolicy(%s, %d) failed but should succeed: %s",
+					test.input, test.policy, err)
+				continue
+			}
+
+			if errors.Is(err, ErrInjection) != test.injection {
+				t.Errorf("EncodeWithPolicy(%s, %d) = %s, wanted injection error %v",
+					test.input, test.policy, err, test.injection)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("EncodeWithPolicy(%s, %d) succeeded but should fail",
+				test.input, test.policy)
+			continue
+		}
+
+		if buf != test.output {
+			t.Errorf("EncodeWithPolicy(%s, %d) = %q, wanted %q", test.input,
+				test.policy, buf, test.output)
+		}
+	}
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	tests := []struct {
+		input   Message
+		output  string
+		success bool
+	}{
+		{
+			Message{
+				Tags:    map[string]string{"b": "x;y z\\w\r\n", "a": ""},
+				Command: "PRIVMSG",
+				Params:  []string{"#test", "hi"},
+			},
+			"@a;b=x\\:y\\sz\\\\w\\r\\n PRIVMSG #test hi\r\n",
+			true,
+		},
+		{
+			Message{
+				Tags:    map[string]string{"+example.com/typing": "active"},
+				Command: "TAGMSG",
+				Params:  []string{"#test"},
+			},
+			"@+example.com/typing=active TAGMSG #test\r\n",
+			true,
+		},
+		// Invalid keys.
+		{
+			Message{Tags: map[string]string{"a b": "c"}, Command: "PING"},
+			"",
+			false,
+		},
+		{
+			Message{Tags: map[string]string{"/x": "c"}, Command: "PING"},
+			"",
+			false,
+		},
+		// The tag limit is separate from the line limit.
+		{
+			Message{
+				Tags:    map[string]string{"long": strings.Repeat("x", 8000)},
+				Command: "PING",
+			},
+			"@long=" + strings.Repeat("x", 8000) + " PING\r\n",
+			true,
+		},
+		{
+			Message{
+				Tags:    map[string]string{"long": strings.Repeat("x", 9000)},
+				Command: "PING",
+			},
+			"",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		buf, err := test.input.Encode()
+		if err != nil {
+			if test.success {
+				t.Errorf("Encode(%s) failed but should succeed: %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("Encode(%s) succeeded but should fail", test.input)
+			continue
+		}
+
+		if buf != test.output {
+			t.Errorf("Encode(%s) = %q, wanted %q", test.input, buf, test.output)
+			continue
+		}
+
+		m, err := ParseMessage(buf)
+		if err != nil {
+			t.Errorf("ParseMessage(%q) = %s", buf, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(m.Tags, test.input.Tags) {
+			t.Errorf("ParseMessage(%q) tags = %q, wanted %q", buf, m.Tags,
+				test.input.Tags)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package irc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrLabelTimeout is the error a LabeledResponse has if the server did not
+// answer in time.
+var ErrLabelTimeout = errors.New("timed out waiting for labeled response")
+
+// LabeledResponse is the server's answer to a labeled command.
+type LabeledResponse struct {
+	// Label is the label we sent.
+	Label string
+
+	// Request is the command we sent.
+	Request Message
+
+	// Messages holds the reply if it was not a batch. It is a single message.
+	// If the server had nothing to say it is an ACK.
+	Messages []Message
+
+	// Batch holds the reply if it was a labeled-response batch.
+	Batch *Batch
+
+	// Err is set if there was no reply, such as ErrLabelTimeout, or if the
+	// reply includes a FAIL. In that case it is a *StandardReply.
+	Err error
+}
+
+// LabelTracker correlates commands with their replies using labeled-response.
+// The labeled-response capability must be enabled.
+//
+// Label commands with Send and send the result. Give it messages that are not
+// part of a batch with Add and batches from a BatchTracker with AddBatch. When
+// a reply arrives we deliver it on the channel Send returned. Call Expire
+// periodically to time out commands that get no reply.
+//
+// It is safe for concurrent use.
+type LabelTracker struct {
+	timeout time.Duration
+
+	// now tells the time. We replace it in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	next    uint64
+	pending map[string]*pendingLabel
+}
+
+type pendingLabel struct {
+	request Message
+	sent    time.Time
+	ch      chan *LabeledResponse
+}
+
+// NewLabelTracker creates a LabelTracker. Commands time out if there is no
+// reply within timeout.
+func NewLabelTracker(timeout time.Duration) *LabelTracker {
+	return &LabelTracker{
+		timeout: timeout,
+		now:     time.Now,
+		pending: map[string]*pendingLabel{},
+	}
+}
+
+// Send labels a command. It returns the labeled command to send and a channel
+// that receives the response. The channel receives exactly one response.
+func (t *LabelTracker) Send(m Message) (Message, <-chan *LabeledResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next++
+	label := "L" + strconv.FormatUint(t.next, 36)
+
+	m = m.WithLabel(label)
+	p := &pendingLabel{
+		request: m,
+		sent:    t.now(),
+		ch:      make(chan *LabeledResponse, 1),
+	}
+	t.pending[label] = p
+
+	return m, p.ch
+}
+
+// Pending returns how many commands are waiting for a reply.
+func (t *LabelTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// Add processes a message that is not part of a batch. If it answers one of
+// our commands we deliver it and return true.
+func (t *LabelTracker) Add(m Message) bool {
+	p, label := t.take(m.Label())
+	if p == nil {
+		return false
+	}
+
+	p.ch <- &LabeledResponse{
+		Label:    label,
+		Request:  p.request,
+		Messages: []Message{m},
+		Err:      FailError(m),
+	}
+	return true
+}
+
+// AddBatch processes a complete batch. If it answers one of our commands we
+// deliver it and return true.
+func (t *LabelTracker) AddBatch(b *Batch) bool {
+	p, label := t.take(b.Start.Label())
+	if p == nil {
+		return false
+	}
+
+	resp := &LabeledResponse{
+		Label:   label,
+		Request: p.request,
+		Batch:   b,
+	}
+	for _, m := range b.Messages {
+		if err := FailError(m); err != nil {
+			resp.Err = err
+			break
+		}
+	}
+
+	p.ch <- resp
+	return true
+}
+
+// take removes and returns the pending command with the label.
+func (t *LabelTracker) take(label string) (*pendingLabel, string) {
+	if label == "" {
+		return nil, ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pending[label]
+	if !ok {
+		return nil, ""
+	}
+	delete(t.pending, label)
+	return p, label
+}
+
+// Expire times out commands that have waited too long. Each gets a response
+// with ErrLabelTimeout. It returns how many timed out.
+//
+// If a reply arrives after this, Add and AddBatch ignore it.
+func (t *LabelTracker) Expire() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	expired := 0
+	for label, p := range t.pending {
+		if now.Sub(p.sent) < t.timeout {
+			continue
+		}
+
+		delete(t.pending, label)
+		p.ch <- &LabeledResponse{
+			Label:   label,
+			Request: p.request,
+			Err:     ErrLabelTimeout,
+		}
+		expired++
+	}
+
+	return expired
+}
@@ -0,0 +1,105 @@
+package irc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLabelTracker(t *testing.T) {
+	tracker := NewLabelTracker(time.Minute)
+
+	who, whoCh := tracker.Send(Message{Command: "WHO", Params: []string{"#test"}})
+	nick, nickCh := tracker.Send(Message{Command: "NICK",
+		Params: []string{"alice"}})
+	if who.Label() == "" || who.Label() == nick.Label() {
+		t.Fatalf("labels are %q and %q", who.Label(), nick.Label())
+	}
+
+	batches := NewBatchTracker()
+	lines := []string{
+		"@label=" + nick.Label() + " :alice!a@h NICK alice2\r\n",
+		"@label=" + who.Label() + " :irc BATCH +b1 labeled-response\r\n",
+		"@batch=b1 :irc 352 me #test ~a h irc alice2 H :0 A\r\n",
+		// Unrelated traffic.
+		":bob!b@h PRIVMSG #test :hi\r\n",
+		"@label=unknown :irc ACK\r\n",
+		"@batch=b1 :irc 315 me #test :End of /WHO list.\r\n",
+		":irc BATCH -b1\r\n",
+	}
+
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		b, held, err := batches.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+		if b != nil {
+			if !tracker.AddBatch(b) {
+				t.Errorf("AddBatch(%s) did not match", b.Ref)
+			}
+			continue
+		}
+		if held {
+			continue
+		}
+
+		tracker.Add(m)
+	}
+
+	select {
+	case resp := <-nickCh:
+		if resp.Err != nil || len(resp.Messages) != 1 ||
+			resp.Messages[0].Command != "NICK" || resp.Request.Command != "NICK" {
+			t.Errorf("NICK response is %+v", resp)
+		}
+	default:
+		t.Errorf("no response for NICK")
+	}
+
+	select {
+	case resp := <-whoCh:
+		if resp.Err != nil || resp.Batch == nil || len(resp.Batch.Messages) != 2 {
+			t.Errorf("WHO response is %+v", resp)
+		}
+	default:
+		t.Errorf("no response for WHO")
+	}
+
+	if tracker.Pending() != 0 {
+		t.Errorf("Pending() = %d, wanted 0", tracker.Pending())
+	}
+}
+
+func TestLabelTrackerExpire(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewLabelTracker(10 * time.Second)
+	tracker.now = func() time.Time { return now }
+
+	m, ch := tracker.Send(Message{Command: "AWAY"})
+
+	now = now.Add(5 * time.Second)
+	if n := tracker.Expire(); n != 0 {
+		t.Errorf("Expire() = %d before the timeout, wanted 0", n)
+	}
+
+	now = now.Add(5 * time.Second)
+	if n := tracker.Expire(); n != 1 {
+		t.Errorf("Expire() = %d after the timeout, wanted 1", n)
+	}
+
+	resp := <-ch
+	if !errors.Is(resp.Err, ErrLabelTimeout) || resp.Label != m.Label() {
+		t.Errorf("response is %+v, wanted a timeout", resp)
+	}
+
+	// A late reply is not ours any more.
+	if tracker.Add(Message{Tags: map[string]string{TagLabel: m.Label()},
+		Command: "ACK"}) {
+		t.Errorf("Add() accepted a reply after the timeout")
+	}
+}
@@ -0,0 +1,234 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/horgh/irc/format"
+)
+
+// TagMultilineConcat is the tag marking a line of a multiline batch that
+// continues the previous line rather than starting a new one.
+const TagMultilineConcat = "draft/multiline-concat"
+
+// CapMultiline is the name of the multiline capability.
+const CapMultiline = "draft/multiline"
+
+// relayPrefixReserve is how much of MaxLineLength we leave for the prefix the
+// server adds when it relays our message (:nick!user@host ). We can't know it
+// exactly.
+const relayPrefixReserve = 100
+
+// MultilineLimits are the limits a server places on multiline batches. They
+// come from the draft/multiline capability's value.
+type MultilineLimits struct {
+	// MaxBytes is the maximum total length of the lines in a batch.
+	MaxBytes int
+
+	// MaxLines is the maximum number of lines in a batch. Zero means there is
+	// no limit.
+	MaxLines int
+}
+
+// ParseMultilineLimits parses the draft/multiline capability's value, such as
+// max-bytes=4096,max-lines=24.
+func ParseMultilineLimits(value string) (MultilineLimits, error) {
+	var limits MultilineLimits
+
+	for _, field := range strings.Split(value, ",") {
+		if field == "" {
+			continue
+		}
+
+		idx := strings.IndexByte(field, '=')
+		if idx == -1 {
+			continue
+		}
+
+		n, err := strconv.Atoi(field[idx+1:])
+		if err != nil || n < 1 {
+			return MultilineLimits{}, fmt.Errorf("invalid value: %s", field)
+		}
+
+		switch field[:idx] {
+		case "max-bytes":
+			limits.MaxBytes = n
+		case "max-lines":
+			limits.MaxLines = n
+		}
+	}
+
+	if limits.MaxBytes == 0 {
+		return MultilineLimits{}, fmt.Errorf("max-bytes is required")
+	}
+
+	return limits, nil
+}
+
+// TextMessages returns the messages to send possibly multi-line text to a
+// target. command is PRIVMSG or NOTICE.
+//
+// If the server supports draft/multiline, we send the text in multiline
+// batches. value is the capability's value. Otherwise we send each line as a
+// separate message. We split lines that are too long either way.
+//
+// With a CapNegotiator:
+//
+//	value, ok := n.Value(CapMultiline)
+//	msgs, err := TextMessages("PRIVMSG", "#channel", text, value, ok)
+func TextMessages(command, target, text, value string,
+	supported bool) ([]Message, error) {
+	if !supported {
+		return SplitText(command, target, text), nil
+	}
+
+	limits, err := ParseMultilineLimits(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []Message
+	for _, b := range MultilineBatches(command, target, text, limits) {
+		msgs = append(msgs, b.Flatten()...)
+	}
+	return msgs, nil
+}
+
+// SplitText returns a message for each line of the text. We split long lines
+// and preserve formatting across the split. We skip empty lines since we
+// can't send empty messages. Lines may end with CRLF or LF.
+func SplitText(command, target, text string) []Message {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+
+	var msgs []Message
+	for _, line := range format.Split(text, textLength(command, target)) {
+		if line == "" {
+			continue
+		}
+		msgs = append(msgs, Message{Command: command,
+			Params: []string{target, line}})
+	}
+	return msgs
+}
+
+// MultilineBatches creates draft/multiline batches holding the text.
+//
+// We use as few batches as the limits permit. We split long lines into pieces
+// tagged with draft/multiline-concat. We prefer to split after a space.
+//
+// Servers reject a batch with nothing but blank lines, so we never start a
+// batch with one. We drop blank lines that would. If the text has only blank
+// lines we return no batches.
+func MultilineBatches(command, target, text string,
+	limits MultilineLimits) []*Batch {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if strings.Trim(text, "\n") == "" {
+		return nil
+	}
+
+	maxPiece := textLength(command, target)
+	if limits.MaxBytes < maxPiece {
+		maxPiece = limits.MaxBytes
+	}
+
+	var batches []*Batch
+	var b *Batch
+	bytes := 0
+
+	add := func(piece string, concat bool) {
+		full := b == nil || bytes+len(piece) > limits.MaxBytes ||
+			(limits.MaxLines > 0 && len(b.Messages) >= limits.MaxLines)
+		if full {
+			// Don't start a batch with a blank line. The batch could end up with
+			// nothing else, which servers reject. The new batch shows as a new
+			// message anyway.
+			if piece == "" {
+				return
+			}
+
+			b = NewBatch("", BatchMultiline, target)
+			batches = append(batches, b)
+			bytes = 0
+			// A new batch starts a new line.
+			concat = false
+		}
+
+		m := Message{Command: command, Params: []string{target, piece}}
+		if concat {
+			m = m.WithTag(TagMultilineConcat, "")
+		}
+		b.Messages = append(b.Messages, m)
+		bytes += len(piece)
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			add("", false)
+			continue
+		}
+
+		for i := 0; line != ""; i++ {
+			piece := splitPiece(line, maxPiece)
+			line = line[len(piece):]
+			add(piece, i > 0)
+		}
+	}
+
+	return batches
+}
+
+// splitPiece returns the longest prefix of s that fits in maxBytes, ending
+// after a space if there is one. We never split a UTF-8 character.
+func splitPiece(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	if end == 0 {
+		// maxBytes is too small for the first character. Take it anyway.
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size]
+	}
+
+	if idx := strings.LastIndexByte(s[:end], ' '); idx > 0 {
+		return s[:idx+1]
+	}
+	return s[:end]
+}
+
+// textLength is how much text fits in a message to the target once the
+// server adds its prefix.
+//
+// :<prefix> <command> <target> :<text>\r\n
+func textLength(command, target string) int {
+	return MaxLineLength - relayPrefixReserve - len(command) - len(target) -
+		len("  :\r\n")
+}
+
+// MultilineText reassembles the text of a draft/multiline batch.
+func MultilineText(b *Batch) (string, error) {
+	if b.Type != BatchMultiline {
+		return "", fmt.Errorf("not a multiline batch: %s", b.Type)
+	}
+
+	var text strings.Builder
+	for i, m := range b.Messages {
+		if (m.Command != "PRIVMSG" && m.Command != "NOTICE") ||
+			len(m.Params) != 2 {
+			return "", fmt.Errorf("unexpected message in multiline batch: %s", m)
+		}
+
+		if _, concat := m.Tag(TagMultilineConcat); i > 0 && !concat {
+			text.WriteString("\n")
+		}
+		text.WriteString(m.Params[1])
+	}
+
+	return text.String(), nil
+}
@@ -0,0 +1,235 @@
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMultilineLimits(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    MultilineLimits
+		success bool
+	}{
+		{"max-bytes=4096", MultilineLimits{MaxBytes: 4096}, true},
+		{"max-bytes=4096,max-lines=24", MultilineLimits{MaxBytes: 4096,
+			MaxLines: 24}, true},
+		{"max-lines=24", MultilineLimits{}, false},
+		{"max-bytes=abc", MultilineLimits{}, false},
+		{"", MultilineLimits{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMultilineLimits(test.input)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseMultilineLimits(%q) = %s", test.input, err)
+			}
+			continue
+		}
+		if !test.success {
+			t.Errorf("ParseMultilineLimits(%q) succeeded, wanted error", test.input)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMultilineLimits(%q) = %+v, wanted %+v", test.input, got,
+				test.want)
+		}
+	}
+}
+
+func TestMultilineRoundTrip(t *testing.T) {
+	long := strings.Repeat("word ", 200)
+
+	tests := []struct {
+		text    string
+		limits  MultilineLimits
+		batches int
+	}{
+		{"one\ntwo\n\nfour", MultilineLimits{MaxBytes: 4096}, 1},
+		{"line\n" + long + "\nend", MultilineLimits{MaxBytes: 4096}, 1},
+		// The line limit forces a second batch.
+		{"a\nb\nc", MultilineLimits{MaxBytes: 4096, MaxLines: 2}, 2},
+		{strings.Repeat("\u00e9", 300), MultilineLimits{MaxBytes: 4096}, 1},
+	}
+
+	for _, test := range tests {
+		batches := MultilineBatches("PRIVMSG", "#test", test.text, test.limits)
+		if len(batches) != test.batches {
+			t.Errorf("MultilineBatches(%q) gave %d batches, wanted %d", test.text,
+				len(batches), test.batches)
+			continue
+		}
+
+		// Send every batch through encoding, decoding, and the tracker.
+		tracker := NewBatchTracker()
+		var texts []string
+		for _, b := range batches {
+			if test.limits.MaxLines > 0 && len(b.Messages) > test.limits.MaxLines {
+				t.Errorf("batch has %d lines, limit is %d", len(b.Messages),
+					test.limits.MaxLines)
+			}
+
+			for _, m := range b.Flatten() {
+				buf, err := m.Encode()
+				if err != nil {
+					t.Fatalf("Encode(%s) = %s", m, err)
+				}
+				if m.Command == "PRIVMSG" &&
+					len(m.Params[1]) > textLength("PRIVMSG", "#test") {
+					t.Errorf("line is too long: %q", buf)
+				}
+
+				parsed, err := ParseMessage(buf)
+				if err != nil {
+					t.Fatalf("ParseMessage(%q) = %s", buf, err)
+				}
+
+				got, _, err := tracker.Add(parsed)
+				if err != nil {
+					t.Fatalf("Add(%s) = %s", parsed, err)
+				}
+				if got == nil {
+					continue
+				}
+
+				text, err := MultilineText(got)
+				if err != nil {
+					t.Fatalf("MultilineText() = %s", err)
+				}
+				texts = append(texts, text)
+			}
+		}
+
+		if got := strings.Join(texts, "\n"); got != test.text {
+			t.Errorf("reassembled %q, wanted %q", got, test.text)
+		}
+	}
+}
+
+func TestMultilineBatchesBlank(t *testing.T) {
+	limits := MultilineLimits{MaxBytes: 4096}
+
+	for _, text := range []string{"", "\n", "\r\n\r\n"} {
+		if batches := MultilineBatches("PRIVMSG", "#test", text,
+			limits); batches != nil {
+			t.Errorf("MultilineBatches(%q) = %v, wanted none", text, batches)
+		}
+
+		msgs, err := TextMessages("PRIVMSG", "#test", text, "max-bytes=4096",
+			true)
+		if err != nil || msgs != nil {
+			t.Errorf("TextMessages(%q) = %v, %v, wanted none", text, msgs, err)
+		}
+	}
+}
+
+func TestMultilineBatchesBlankBoundary(t *testing.T) {
+	tests := []struct {
+		text   string
+		limits MultilineLimits
+		output [][]string
+	}{
+		{
+			"a\n\nb",
+			MultilineLimits{MaxBytes: 4096, MaxLines: 1},
+			[][]string{{"a"}, {"b"}},
+		},
+		{
+			"a\n\n\nb\n\nc",
+			MultilineLimits{MaxBytes: 4096, MaxLines: 2},
+			[][]string{{"a", ""}, {"b", ""}, {"c"}},
+		},
+		{
+			"\n\na",
+			MultilineLimits{MaxBytes: 4096},
+			[][]string{{"a"}},
+		},
+		{
+			"aaaa\n\nbb",
+			MultilineLimits{MaxBytes: 4},
+			[][]string{{"aaaa", ""}, {"bb"}},
+		},
+	}
+
+	for _, test := range tests {
+		var output [][]string
+		for _, b := range MultilineBatches("PRIVMSG", "#a", test.text,
+			test.limits) {
+			var lines []string
+			for _, m := range b.Messages {
+				lines = append(lines, m.Params[1])
+			}
+			output = append(output, lines)
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("MultilineBatches(%q, %+v) = %q, wanted %q", test.text,
+				test.limits, output, test.output)
+		}
+	}
+}
+
+func TestTextMessages(t *testing.T) {
+	msgs, err := TextMessages("PRIVMSG", "#test", "one\n\ntwo", "", false)
+	if err != nil {
+		t.Fatalf("TextMessages() = %s", err)
+	}
+
+	want := []Message{
+		{Command: "PRIVMSG", Params: []string{"#test", "one"}},
+		{Command: "PRIVMSG", Params: []string{"#test", "two"}},
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("TextMessages() = %v, wanted %v", msgs, want)
+	}
+
+	msgs, err = TextMessages("PRIVMSG", "#test", "one\ntwo",
+		"max-bytes=4096", true)
+	if err != nil {
+		t.Fatalf("TextMessages() = %s", err)
+	}
+
+	// BATCH +, two lines, BATCH -.
+	if len(msgs) != 4 || msgs[0].Command != "BATCH" ||
+		msgs[1].Batch() == "" {
+		t.Errorf("TextMessages() = %v", msgs)
+	}
+
+	if _, err := TextMessages("PRIVMSG", "#test", "x", "bogus", true); err == nil {
+		t.Errorf("TextMessages() with a bad value succeeded")
+	}
+}
+
+func TestSplitTextCRLF(t *testing.T) {
+	msgs := SplitText("PRIVMSG", "#test", "one\r\ntwo\r\n")
+
+	want := []Message{
+		{Command: "PRIVMSG", Params: []string{"#test", "one"}},
+		{Command: "PRIVMSG", Params: []string{"#test", "two"}},
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("SplitText() = %v, wanted %v", msgs, want)
+	}
+
+	for _, m := range msgs {
+		if _, err := m.Encode(); err != nil {
+			t.Errorf("Encode(%s) = %s", m, err)
+		}
+	}
+}
+
+func TestSplitTextLongLine(t *testing.T) {
+	text := strings.Repeat("word ", 200)
+	msgs := SplitText("PRIVMSG", "#test", text)
+	if len(msgs) < 3 {
+		t.Fatalf("SplitText() gave %d messages, wanted at least 3", len(msgs))
+	}
+
+	for _, m := range msgs {
+		if len(m.Params[1]) > textLength("PRIVMSG", "#test") {
+			t.Errorf("message is too long: %d bytes", len(m.Params[1]))
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package irc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sender sends messages. Client implements it.
+type Sender interface {
+	Send(m Message) error
+}
+
+// Handler responds to a message.
+type Handler interface {
+	ServeIRC(r *Replier, m Message)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(r *Replier, m Message)
+
+// ServeIRC calls f(r, m).
+func (f HandlerFunc) ServeIRC(r *Replier, m Message) {
+	f(r, m)
+}
+
+// Middleware wraps a Handler, such as to log or filter messages.
+type Middleware func(Handler) Handler
+
+// Mux dispatches messages to handlers by command.
+//
+// Patterns are commands such as PRIVMSG, numerics such as 001, or a prefix
+// followed by *. For example 4* matches every numeric starting with 4 and *
+// matches everything. An exact pattern wins over a wildcard, and a longer
+// wildcard wins over a shorter one.
+//
+// Handlers registered with HandleCTCP get CTCP requests, which are PRIVMSGs.
+// A CTCP request without a handler for its verb goes to the PRIVMSG handler.
+//
+// It is safe for concurrent use.
+type Mux struct {
+	mu         sync.RWMutex
+	exact      map[string]Handler
+	wildcards  []muxWildcard
+	ctcp       map[string]Handler
+	middleware []Middleware
+}
+
+type muxWildcard struct {
+	prefix  string
+	handler Handler
+}
+
+// NewMux creates a Mux.
+func NewMux() *Mux {
+	return &Mux{
+		exact: map[string]Handler{},
+		ctcp:  map[string]Handler{},
+	}
+}
+
+// Handle registers the handler for the pattern. It replaces any handler
+// already registered for it.
+func (mux *Mux) Handle(pattern string, h Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	pattern = strings.ToUpper(pattern)
+
+	if !strings.HasSuffix(pattern, "*") {
+		mux.exact[pattern] = h
+		return
+	}
+
+	prefix := strings.TrimSuffix(pattern, "*")
+	for i, w := range mux.wildcards {
+		if w.prefix == prefix {
+			mux.wildcards[i].handler = h
+			return
+		}
+	}
+
+	mux.wildcards = append(mux.wildcards, muxWildcard{prefix: prefix,
+		handler: h})
+	sort.Slice(mux.wildcards, func(i, j int) bool {
+		return len(mux.wildcards[i].prefix) > len(mux.wildcards[j].prefix)
+	})
+}
+
+// HandleFunc registers the function for the pattern.
+func (mux *Mux) HandleFunc(pattern string, f func(r *Replier, m Message)) {
+	mux.Handle(pattern, HandlerFunc(f))
+}
+
+// HandleCTCP registers the handler for a CTCP verb, such as VERSION.
+func (mux *Mux) HandleCTCP(verb string, h Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.ctcp[strings.ToUpper(verb)] = h
+}
+
+// HandleCTCPFunc registers the function for a CTCP verb.
+func (mux *Mux) HandleCTCPFunc(verb string, f func(r *Replier, m Message)) {
+	mux.HandleCTCP(verb, HandlerFunc(f))
+}
+
+// Use adds middleware. Every message passes through it, in the order added,
+// before reaching a handler. This includes messages no handler matches.
+func (mux *Mux) Use(middleware ...Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.middleware = append(mux.middleware, middleware...)
+}
+
+// Handler returns the handler for the message. If there is none it returns
+// nil.
+func (mux *Mux) Handler(m Message) Handler {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	command := strings.ToUpper(m.Command)
+
+	if command == "PRIVMSG" && len(m.Params) > 1 {
+		if verb, _, ok := ParseCTCP(m.Params[1]); ok {
+			if h, ok := mux.ctcp[verb]; ok {
+				return h
+			}
+		}
+	}
+
+	if h, ok := mux.exact[command]; ok {
+		return h
+	}
+
+	for _, w := range mux.wildcards {
+		if strings.HasPrefix(command, w.prefix) {
+			return w.handler
+		}
+	}
+
+	return nil
+}
+
+// ServeIRC passes the message through the middleware to its handler.
+func (mux *Mux) ServeIRC(r *Replier, m Message) {
+	mux.mu.RLock()
+	middleware := mux.middleware
+	mux.mu.RUnlock()
+
+	var h Handler = HandlerFunc(func(r *Replier, m Message) {
+		if h := mux.Handler(m); h != nil {
+			h.ServeIRC(r, m)
+		}
+	})
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	h.ServeIRC(r, m)
+}
+
+// Dispatch handles a message, replying using the sender.
+func (mux *Mux) Dispatch(s Sender, m Message) {
+	mux.ServeIRC(&Replier{Sender: s, Message: m}, m)
+}
+
+// Replier sends replies to a message.
+type Replier struct {
+	Sender Sender
+
+	// Message is the message being replied to.
+	Message Message
+}
+
+// Target returns where replies go. For a message to a channel this is the
+// channel. Otherwise it is the sender's nick.
+func (r *Replier) Target() string {
+	if (r.Message.Command == "PRIVMSG" || r.Message.Command == "NOTICE") &&
+		len(r.Message.Params) > 0 && IsChannel(r.Message.Params[0]) {
+		return r.Message.Params[0]
+	}
+	return r.Message.SourceNick()
+}
+
+// Reply sends a PRIVMSG to the target. We split long or multi-line text
+// into several messages.
+func (r *Replier) Reply(text string) error {
+	return r.sendText("PRIVMSG", r.Target(), text)
+}
+
+// Replyf is like Reply but formats the text.
+func (r *Replier) Replyf(format string, args ...interface{}) error {
+	return r.Reply(fmt.Sprintf(format, args...))
+}
+
+// Notice sends a NOTICE to the target.
+func (r *Replier) Notice(text string) error {
+	return r.sendText("NOTICE", r.Target(), text)
+}
+
+// CTCPReply answers a CTCP request. The answer goes to the sender as a
+// NOTICE.
+func (r *Replier) CTCPReply(verb, args string) error {
+	return r.Sender.Send(Message{Command: "NOTICE",
+		Params: []string{r.Message.SourceNick(), CTCP(verb, args)}})
+}
+
+func (r *Replier) sendText(command, target, text string) error {
+	if target == "" {
+		return fmt.Errorf("no one to reply to")
+	}
+
+	for _, m := range SplitText(command, target, text) {
+		if err := r.Sender.Send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover is middleware that recovers from panics in handlers. It reports
+// each panic and the stack to logf.
+func Recover(logf func(format string, args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(r *Replier, m Message) {
+			defer func() {
+				if v := recover(); v != nil {
+					logf("panic handling %s: %v\n%s", m.SafeString(), v, debug.Stack())
+				}
+			}()
+			next.ServeIRC(r, m)
+		})
+	}
+}
+
+// Logger is middleware that logs each message to logf.
+func Logger(logf func(format string, args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(r *Replier, m Message) {
+			logf("%s", m.SafeString())
+			next.ServeIRC(r, m)
+		})
+	}
+}
+
+// Ignore is middleware that drops messages for which ignore returns true.
+func Ignore(ignore func(m Message) bool) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(r *Replier, m Message) {
+			if ignore(m) {
+				return
+			}
+			next.ServeIRC(r, m)
+		})
+	}
+}
+
+// IgnoreNicks is middleware that drops messages from the nicks.
+func IgnoreNicks(nicks ...string) Middleware {
+	ignored := map[string]struct{}{}
+	for _, nick := range nicks {
+		ignored[foldName(nick)] = struct{}{}
+	}
+
+	return Ignore(func(m Message) bool {
+		_, ok := ignored[foldName(m.SourceNick())]
+		return ok
+	})
+}
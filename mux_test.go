@@ -0,0 +1,220 @@
+package irc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordingSender struct {
+	messages []Message
+}
+
+func (s *recordingSender) Send(m Message) error {
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func TestMuxRouting(t *testing.T) {
+	mux := NewMux()
+
+	var got []string
+	record := func(name string) HandlerFunc {
+		return func(r *Replier, m Message) { got = append(got, name) }
+	}
+
+	mux.Handle("PRIVMSG", record("privmsg"))
+	mux.Handle("001", record("welcome"))
+	mux.Handle("4*", record("errors"))
+	mux.Handle("43*", record("nick errors"))
+	mux.Handle("*", record("fallback"))
+	mux.HandleCTCP("version", record("version"))
+
+	tests := []struct {
+		input  Message
+		output string
+	}{
+		{Message{Command: "PRIVMSG", Params: []string{"#test", "hi"}}, "privmsg"},
+		{Message{Command: "privmsg", Params: []string{"#test", "hi"}}, "privmsg"},
+		{Message{Command: "PRIVMSG", Params: []string{"bot", "\x01VERSION\x01"}},
+			"version"},
+		{Message{Command: "PRIVMSG", Params: []string{"bot", "\x01PING 1\x01"}},
+			"privmsg"},
+		{Message{Command: "NOTICE", Params: []string{"bot", "\x01VERSION x\x01"}},
+			"fallback"},
+		{Message{Command: "001", Params: []string{"bot", "Welcome"}}, "welcome"},
+		{Message{Command: "433", Params: []string{"*", "bot", "In use"}},
+			"nick errors"},
+		{Message{Command: "401", Params: []string{"bot", "x", "No such nick"}},
+			"errors"},
+		{Message{Command: "JOIN", Params: []string{"#test"}}, "fallback"},
+	}
+
+	for _, test := range tests {
+		got = nil
+		mux.Dispatch(&recordingSender{}, test.input)
+		if len(got) != 1 || got[0] != test.output {
+			t.Errorf("Dispatch(%s) called %v, wanted %s", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestMuxNoHandler(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("PRIVMSG", HandlerFunc(func(r *Replier, m Message) {
+		t.Errorf("unexpected call for %s", m)
+	}))
+
+	if h := mux.Handler(Message{Command: "JOIN"}); h != nil {
+		t.Errorf("Handler(JOIN) = %v, wanted nil", h)
+	}
+	mux.Dispatch(&recordingSender{}, Message{Command: "JOIN"})
+}
+
+func TestMuxMiddleware(t *testing.T) {
+	mux := NewMux()
+
+	var calls []string
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(r *Replier, m Message) {
+			calls = append(calls, "first")
+			next.ServeIRC(r, m)
+		})
+	}, func(next Handler) Handler {
+		return HandlerFunc(func(r *Replier, m Message) {
+			calls = append(calls, "second")
+			next.ServeIRC(r, m)
+		})
+	})
+	mux.HandleFunc("PING", func(r *Replier, m Message) {
+		calls = append(calls, "handler")
+	})
+
+	mux.Dispatch(&recordingSender{}, Message{Command: "PING",
+		Params: []string{"x"}})
+	if want := []string{"first", "second", "handler"}; !reflect.DeepEqual(calls,
+		want) {
+		t.Errorf("calls = %v, wanted %v", calls, want)
+	}
+
+	calls = nil
+	mux.Dispatch(&recordingSender{}, Message{Command: "JOIN"})
+	if want := []string{"first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, wanted %v", calls, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	mux := NewMux()
+
+	var logged []string
+	mux.Use(Recover(func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}))
+	mux.HandleFunc("PRIVMSG", func(r *Replier, m Message) {
+		panic("oops")
+	})
+
+	mux.Dispatch(&recordingSender{}, Message{Command: "PRIVMSG",
+		Params: []string{"#test", "hi"}})
+
+	if len(logged) != 1 || !strings.Contains(logged[0], "oops") {
+		t.Errorf("logged %q, wanted a panic report", logged)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	mux := NewMux()
+
+	var logged []string
+	mux.Use(Logger(func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}))
+
+	mux.Dispatch(&recordingSender{}, Message{Prefix: "nick!u@h",
+		Command: "PRIVMSG", Params: []string{"#test", "hi\x1b[2J"}})
+
+	if len(logged) != 1 || !strings.Contains(logged[0], "nick!u@h") ||
+		strings.Contains(logged[0], "\x1b") {
+		t.Errorf("logged %q, wanted one sanitized line", logged)
+	}
+}
+
+func TestIgnoreNicks(t *testing.T) {
+	mux := NewMux()
+	mux.Use(IgnoreNicks("Spammer"))
+
+	count := 0
+	mux.HandleFunc("PRIVMSG", func(r *Replier, m Message) { count++ })
+
+	mux.Dispatch(&recordingSender{}, Message{Prefix: "spammer!u@h",
+		Command: "PRIVMSG", Params: []string{"#test", "buy"}})
+	mux.Dispatch(&recordingSender{}, Message{Prefix: "friend!u@h",
+		Command: "PRIVMSG", Params: []string{"#test", "hi"}})
+
+	if count != 1 {
+		t.Errorf("handled %d messages, wanted 1", count)
+	}
+}
+
+func TestReplier(t *testing.T) {
+	tests := []struct {
+		input  Message
+		target string
+	}{
+		{Message{Prefix: "nick!u@h", Command: "PRIVMSG",
+			Params: []string{"#test", "hi"}}, "#test"},
+		{Message{Prefix: "nick!u@h", Command: "PRIVMSG",
+			Params: []string{"bot", "hi"}}, "nick"},
+		{Message{Prefix: "nick!u@h", Command: "JOIN",
+			Params: []string{"#test"}}, "nick"},
+	}
+
+	for _, test := range tests {
+		s := &recordingSender{}
+		r := &Replier{Sender: s, Message: test.input}
+
+		if target := r.Target(); target != test.target {
+			t.Errorf("Target() for %s = %s, wanted %s", test.input, target,
+				test.target)
+		}
+
+		if err := r.Replyf("hello %s", "there"); err != nil {
+			t.Fatalf("Replyf() failed: %s", err)
+		}
+		want := []Message{{Command: "PRIVMSG",
+			Params: []string{test.target, "hello there"}}}
+		if !reflect.DeepEqual(s.messages, want) {
+			t.Errorf("Replyf() sent %v, wanted %v", s.messages, want)
+		}
+	}
+}
+
+func TestReplierCTCPReply(t *testing.T) {
+	mux := NewMux()
+	mux.HandleCTCPFunc("VERSION", func(r *Replier, m Message) {
+		if err := r.CTCPReply("VERSION", "bot 1.0"); err != nil {
+			t.Errorf("CTCPReply() failed: %s", err)
+		}
+	})
+
+	s := &recordingSender{}
+	mux.Dispatch(s, Message{Prefix: "nick!u@h", Command: "PRIVMSG",
+		Params: []string{"#test", "\x01VERSION\x01"}})
+
+	want := []Message{{Command: "NOTICE",
+		Params: []string{"nick", "\x01VERSION bot 1.0\x01"}}}
+	if !reflect.DeepEqual(s.messages, want) {
+		t.Errorf("sent %v, wanted %v", s.messages, want)
+	}
+}
+
+func TestReplierNoTarget(t *testing.T) {
+	r := &Replier{Sender: &recordingSender{}, Message: Message{Command: "PING",
+		Params: []string{"x"}}}
+	if err := r.Reply("hi"); err == nil {
+		t.Errorf("Reply() with no target succeeded, wanted error")
+	}
+}
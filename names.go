@@ -0,0 +1,247 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prefixes describes the channel membership prefixes a server supports. This
+// comes from the PREFIX ISUPPORT token. For example "(ov)@+" means the mode o
+// is shown as @ and v as +.
+//
+// Modes and Symbols are in order of rank, highest first, and the mode at each
+// index corresponds to the symbol at the same index.
+type Prefixes struct {
+	Modes   string
+	Symbols string
+}
+
+// DefaultPrefixes is what we assume if the server does not tell us its
+// prefixes.
+var DefaultPrefixes = Prefixes{Modes: "ov", Symbols: "@+"}
+
+// ParsePrefixes parses the value of a PREFIX ISUPPORT token. For example
+// "(qaohv)~&@%+".
+//
+// An empty value is valid and means there are no prefixes.
+func ParsePrefixes(value string) (Prefixes, error) {
+	if value == "" {
+		return Prefixes{}, nil
+	}
+
+	if value[0] != '(' {
+		return Prefixes{}, fmt.Errorf("PREFIX does not start with '('")
+	}
+
+	idx := strings.IndexByte(value, ')')
+	if idx == -1 {
+		return Prefixes{}, fmt.Errorf("PREFIX has no ')'")
+	}
+
+	p := Prefixes{Modes: value[1:idx], Symbols: value[idx+1:]}
+	if len(p.Modes) != len(p.Symbols) {
+		return Prefixes{}, fmt.Errorf(
+			"PREFIX has a different number of modes and symbols")
+	}
+
+	return p, nil
+}
+
+// ModeFor returns the mode for a prefix symbol. For example 'o' for '@'. It
+// returns 0 if the symbol is not known.
+func (p Prefixes) ModeFor(symbol byte) byte {
+	idx := strings.IndexByte(p.Symbols, symbol)
+	if idx == -1 {
+		return 0
+	}
+	return p.Modes[idx]
+}
+
+// SymbolFor returns the prefix symbol for a mode. For example '@' for 'o'. It
+// returns 0 if the mode is not known.
+func (p Prefixes) SymbolFor(mode byte) byte {
+	idx := strings.IndexByte(p.Modes, mode)
+	if idx == -1 {
+		return 0
+	}
+	return p.Symbols[idx]
+}
+
+// ChannelVisibility is the channel type symbol in an RPL_NAMREPLY.
+type ChannelVisibility byte
+
+// These are the channel visibility symbols.
+const (
+	ChannelPublic  ChannelVisibility = '='
+	ChannelPrivate ChannelVisibility = '*'
+	ChannelSecret  ChannelVisibility = '@'
+)
+
+// Member is a channel member as shown in an RPL_NAMREPLY.
+type Member struct {
+	Nick string
+
+	// User and Host are set only if the server sent the full nick!user@host
+	// (the userhost-in-names capability).
+	User string
+	Host string
+
+	// Symbols holds the member's prefix symbols, highest rank first. For
+	// example "@+". There will be more than one only if the server sent all of
+	// them (the multi-prefix capability).
+	Symbols string
+
+	// Modes holds the modes corresponding to Symbols. For example "ov".
+	Modes string
+}
+
+// HasMode returns true if the member has the given prefix mode, such as 'o'.
+func (m Member) HasMode(mode byte) bool {
+	return strings.IndexByte(m.Modes, mode) != -1
+}
+
+// ParseNamesEntry parses a single entry from an RPL_NAMREPLY. For example
+// "@+nick" or "@nick!user@host".
+func ParseNamesEntry(entry string, prefixes Prefixes) (Member, error) {
+	member := Member{}
+
+	i := 0
+	for i < len(entry) {
+		mode := prefixes.ModeFor(entry[i])
+		if mode == 0 {
+			break
+		}
+		member.Symbols += string(entry[i])
+		member.Modes += string(mode)
+		i++
+	}
+
+	nick := entry[i:]
+	if idx := strings.IndexByte(nick, '!'); idx != -1 {
+		userHost := nick[idx+1:]
+		nick = nick[:idx]
+
+		atIdx := strings.IndexByte(userHost, '@')
+		if atIdx == -1 {
+			return Member{}, fmt.Errorf("names entry has no host: %s", entry)
+		}
+		member.User = userHost[:atIdx]
+		member.Host = userHost[atIdx+1:]
+	}
+
+	if nick == "" {
+		return Member{}, fmt.Errorf("names entry has no nick: %s", entry)
+	}
+	member.Nick = nick
+
+	return member, nil
+}
+
+// Names holds a channel's complete NAMES reply.
+type Names struct {
+	Channel string
+
+	Visibility ChannelVisibility
+
+	// Members is in the order the server sent them.
+	Members []Member
+}
+
+// NamesCollector gathers RPL_NAMREPLY messages until the corresponding
+// RPL_ENDOFNAMES arrives.
+//
+// It can collect replies for several channels at once.
+type NamesCollector struct {
+	prefixes Prefixes
+	pending  map[string]*Names
+}
+
+// NewNamesCollector creates a NamesCollector. prefixes should be what the
+// server sent in its PREFIX ISUPPORT token, or DefaultPrefixes if it did not
+// send one.
+func NewNamesCollector(prefixes Prefixes) *NamesCollector {
+	return &NamesCollector{
+		prefixes: prefixes,
+		pending:  map[string]*Names{},
+	}
+}
+
+// SetPrefixes changes the prefixes used to parse entries. For example if we
+// receive ISUPPORT after creating the collector.
+func (c *NamesCollector) SetPrefixes(prefixes Prefixes) {
+	c.prefixes = prefixes
+}
+
+// Add processes a message.
+//
+// When the message is an RPL_ENDOFNAMES, we return the complete reply for its
+// channel and true. For any other message we return false. Messages other
+// than RPL_NAMREPLY and RPL_ENDOFNAMES are ignored.
+//
+// If there were no RPL_NAMREPLY messages for the channel (such as when the
+// channel does not exist) we return a reply with no members.
+//
+// We return an error if the message is malformed.
+func (c *NamesCollector) Add(m Message) (*Names, bool, error) {
+	switch m.Command {
+	case ReplyNamReply:
+		return nil, false, c.addNames(m)
+	case ReplyEndOfNames:
+		// <client> <channel> :End of /NAMES list
+		if len(m.Params) < 2 {
+			return nil, false, fmt.Errorf("malformed RPL_ENDOFNAMES: %s", m)
+		}
+
+		key := foldName(m.Params[1])
+		names, ok := c.pending[key]
+		if !ok {
+			names = &Names{Channel: m.Params[1]}
+		}
+		delete(c.pending, key)
+		return names, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// addNames processes an RPL_NAMREPLY.
+//
+// <client> <symbol> <channel> :[prefix]<nick>{ [prefix]<nick>}
+//
+// Some servers omit <symbol>.
+func (c *NamesCollector) addNames(m Message) error {
+	var visibility ChannelVisibility
+	var channel, entries string
+
+	switch len(m.Params) {
+	case 4:
+		if len(m.Params[1]) != 1 {
+			return fmt.Errorf("malformed RPL_NAMREPLY symbol: %s", m)
+		}
+		visibility = ChannelVisibility(m.Params[1][0])
+		channel = m.Params[2]
+		entries = m.Params[3]
+	case 3:
+		channel = m.Params[1]
+		entries = m.Params[2]
+	default:
+		return fmt.Errorf("malformed RPL_NAMREPLY: %s", m)
+	}
+
+	key := foldName(channel)
+	names, ok := c.pending[key]
+	if !ok {
+		names = &Names{Channel: channel, Visibility: visibility}
+		c.pending[key] = names
+	}
+
+	for _, entry := range strings.Fields(entries) {
+		member, err := ParseNamesEntry(entry, c.prefixes)
+		if err != nil {
+			return err
+		}
+		names.Members = append(names.Members, member)
+	}
+
+	return nil
+}
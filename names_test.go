@@ -0,0 +1,141 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		input   string
+		output  Prefixes
+		success bool
+	}{
+		{"(ov)@+", Prefixes{Modes: "ov", Symbols: "@+"}, true},
+		{"(qaohv)~&@%+", Prefixes{Modes: "qaohv", Symbols: "~&@%+"}, true},
+		{"", Prefixes{}, true},
+		{"()", Prefixes{}, true},
+		{"ov@+", Prefixes{}, false},
+		{"(ov@+", Prefixes{}, false},
+		{"(ov)@", Prefixes{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePrefixes(test.input)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParsePrefixes(%q) = %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("ParsePrefixes(%q) should have failed", test.input)
+			continue
+		}
+
+		if got != test.output {
+			t.Errorf("ParsePrefixes(%q) = %+v, wanted %+v", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestParseNamesEntry(t *testing.T) {
+	prefixes := Prefixes{Modes: "qaohv", Symbols: "~&@%+"}
+
+	tests := []struct {
+		input   string
+		output  Member
+		success bool
+	}{
+		{"nick", Member{Nick: "nick"}, true},
+		{"@nick", Member{Nick: "nick", Symbols: "@", Modes: "o"}, true},
+		{"~@+nick", Member{Nick: "nick", Symbols: "~@+", Modes: "qov"}, true},
+		{
+			"@+nick!~user@example.com",
+			Member{Nick: "nick", User: "~user", Host: "example.com", Symbols: "@+",
+				Modes: "ov"},
+			true,
+		},
+		{"@", Member{}, false},
+		{"nick!user", Member{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseNamesEntry(test.input, prefixes)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseNamesEntry(%q) = %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("ParseNamesEntry(%q) should have failed", test.input)
+			continue
+		}
+
+		if got != test.output {
+			t.Errorf("ParseNamesEntry(%q) = %+v, wanted %+v", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestNamesCollector(t *testing.T) {
+	c := NewNamesCollector(Prefixes{Modes: "ohv", Symbols: "@%+"})
+
+	lines := []string{
+		":irc 353 me = #test :@+alice bob!b@host\r\n",
+		":irc 353 me @ #secret :carol\r\n",
+		":irc PRIVMSG #test :interleaved\r\n",
+		":irc 353 me = #Test :%dave\r\n",
+		":irc 366 me #TEST :End of /NAMES list.\r\n",
+		":irc 366 me #secret :End of /NAMES list.\r\n",
+		":irc 366 me #empty :End of /NAMES list.\r\n",
+	}
+
+	var got []*Names
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		names, done, err := c.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+		if done {
+			got = append(got, names)
+		}
+	}
+
+	want := []*Names{
+		{
+			Channel:    "#test",
+			Visibility: ChannelPublic,
+			Members: []Member{
+				{Nick: "alice", Symbols: "@+", Modes: "ov"},
+				{Nick: "bob", User: "b", Host: "host"},
+				{Nick: "dave", Symbols: "%", Modes: "h"},
+			},
+		},
+		{
+			Channel:    "#secret",
+			Visibility: ChannelSecret,
+			Members:    []Member{{Nick: "carol"}},
+		},
+		{Channel: "#empty"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %+v, wanted %+v", got, want)
+	}
+
+	m := Message{Command: ReplyNamReply, Params: []string{"me"}}
+	if _, _, err := c.Add(m); err == nil {
+		t.Errorf("Add(%s) should have failed", m)
+	}
+}
@@ -0,0 +1,188 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxNickAttempts is how many nicks a NickFallback generates if
+// MaxAttempts is not set.
+const DefaultMaxNickAttempts = 10
+
+// NickGenerator makes a nick to try when the one we want is unavailable.
+// Attempt starts at 1 and increases each time the server rejects a nick.
+type NickGenerator func(nick string, attempt int) string
+
+// NickUnderscore appends an underscore for each attempt. For example it turns
+// alice into alice_, then alice__.
+func NickUnderscore(nick string, attempt int) string {
+	return nick + strings.Repeat("_", attempt)
+}
+
+// NickNumeric appends the attempt number. For example it turns alice into
+// alice1, then alice2.
+func NickNumeric(nick string, attempt int) string {
+	return nick + strconv.Itoa(attempt)
+}
+
+// NickFallback chooses nicks to try when the server rejects ours during
+// registration. We try the alternates in order and then ones the generator
+// makes from the preferred nick.
+type NickFallback struct {
+	// Preferred is the nick we want.
+	Preferred string
+
+	// Alternates are nicks to try first.
+	Alternates []string
+
+	// Generator makes more nicks once we run out of alternates. If it is nil
+	// we give up after the alternates.
+	Generator NickGenerator
+
+	// MaxAttempts is how many nicks the generator may make. If it is zero we
+	// use DefaultMaxNickAttempts.
+	MaxAttempts int
+
+	tried int
+}
+
+// Next returns the next nick to try. It returns false if there are no more.
+func (f *NickFallback) Next() (string, bool) {
+	f.tried++
+
+	if f.tried <= len(f.Alternates) {
+		return f.Alternates[f.tried-1], true
+	}
+
+	if f.Generator == nil {
+		return "", false
+	}
+
+	limit := f.MaxAttempts
+	if limit == 0 {
+		limit = DefaultMaxNickAttempts
+	}
+
+	attempt := f.tried - len(f.Alternates)
+	if attempt > limit {
+		return "", false
+	}
+	return f.Generator(f.Preferred, attempt), true
+}
+
+// NickRegainer tries to get our preferred nick back after we registered with
+// another.
+//
+// If the server supports MONITOR we watch the preferred nick and ask for it
+// when it becomes free. Otherwise call Tick periodically and we ask for it
+// each time.
+//
+// Give it every message from the server with Handle and send what it returns.
+// It expects to see the server's ISUPPORT messages.
+type NickRegainer struct {
+	preferred string
+	current   string
+	monitor   bool
+}
+
+// NewNickRegainer creates a NickRegainer. Current is the nick we have.
+func NewNickRegainer(preferred, current string) *NickRegainer {
+	return &NickRegainer{preferred: preferred, current: current}
+}
+
+// Regained returns true if we have the preferred nick.
+func (r *NickRegainer) Regained() bool {
+	return foldName(r.current) == foldName(r.preferred)
+}
+
+// Monitoring returns true if we are using MONITOR to watch the nick.
+func (r *NickRegainer) Monitoring() bool {
+	return r.monitor
+}
+
+// Handle looks at a message from the server. It returns messages to send.
+func (r *NickRegainer) Handle(m Message) []Message {
+	switch m.Command {
+	case ReplyISupport:
+		if r.monitor || r.Regained() {
+			return nil
+		}
+		if _, ok := isupportToken(m, "MONITOR"); !ok {
+			return nil
+		}
+		r.monitor = true
+		return []Message{r.monitorMessage("+")}
+	case ReplyMonOffline:
+		if len(m.Params) < 2 || r.Regained() {
+			return nil
+		}
+		for _, target := range strings.Split(m.Params[1], ",") {
+			if foldName(target) == foldName(r.preferred) {
+				return []Message{r.nickMessage()}
+			}
+		}
+	case ErrorMonListFull:
+		// We can't watch it. Fall back to asking periodically.
+		r.monitor = false
+	case "NICK":
+		if len(m.Params) == 0 {
+			return nil
+		}
+		source := foldName(m.SourceNick())
+		if source == foldName(r.current) {
+			r.current = m.Params[0]
+			if r.Regained() && r.monitor {
+				r.monitor = false
+				return []Message{r.monitorMessage("-")}
+			}
+			return nil
+		}
+		if source == foldName(r.preferred) && !r.Regained() {
+			return []Message{r.nickMessage()}
+		}
+	case "QUIT":
+		if foldName(m.SourceNick()) == foldName(r.preferred) && !r.Regained() {
+			return []Message{r.nickMessage()}
+		}
+	}
+	return nil
+}
+
+// Tick returns a NICK to try for the preferred nick. It returns nothing if we
+// have the nick or are waiting for MONITOR to tell us it is free.
+func (r *NickRegainer) Tick() []Message {
+	if r.Regained() || r.monitor {
+		return nil
+	}
+	return []Message{r.nickMessage()}
+}
+
+func (r *NickRegainer) nickMessage() Message {
+	return Message{Command: "NICK", Params: []string{r.preferred}}
+}
+
+func (r *NickRegainer) monitorMessage(op string) Message {
+	return Message{Command: "MONITOR", Params: []string{op, r.preferred}}
+}
+
+// isupportToken finds a token in an ISUPPORT message. It returns the token's
+// value, which is blank if it has none.
+func isupportToken(m Message, name string) (string, bool) {
+	if m.Command != ReplyISupport || len(m.Params) < 2 {
+		return "", false
+	}
+
+	// The first param is our nick and the last is human readable text.
+	for _, token := range m.Params[1 : len(m.Params)-1] {
+		key := token
+		value := ""
+		if idx := strings.IndexByte(token, '='); idx != -1 {
+			key = token[:idx]
+			value = token[idx+1:]
+		}
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
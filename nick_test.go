@@ -0,0 +1,177 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNickGenerators(t *testing.T) {
+	tests := []struct {
+		generator NickGenerator
+		attempt   int
+		output    string
+	}{
+		{NickUnderscore, 1, "alice_"},
+		{NickUnderscore, 3, "alice___"},
+		{NickNumeric, 1, "alice1"},
+		{NickNumeric, 12, "alice12"},
+	}
+
+	for _, test := range tests {
+		output := test.generator("alice", test.attempt)
+		if output != test.output {
+			t.Errorf("generator(alice, %d) = %s, wanted %s", test.attempt, output,
+				test.output)
+		}
+	}
+}
+
+func TestNickFallback(t *testing.T) {
+	tests := []struct {
+		fallback NickFallback
+		output   []string
+	}{
+		{
+			NickFallback{Preferred: "alice"},
+			nil,
+		},
+		{
+			NickFallback{Preferred: "alice", Alternates: []string{"bob", "carol"}},
+			[]string{"bob", "carol"},
+		},
+		{
+			NickFallback{Preferred: "alice", Alternates: []string{"bob"},
+				Generator: NickNumeric, MaxAttempts: 2},
+			[]string{"bob", "alice1", "alice2"},
+		},
+		{
+			NickFallback{Preferred: "a", Generator: NickUnderscore},
+			[]string{"a_", "a__", "a___", "a____", "a_____", "a______", "a_______",
+				"a________", "a_________", "a__________"},
+		},
+	}
+
+	for _, test := range tests {
+		fallback := test.fallback
+
+		var output []string
+		for {
+			nick, ok := fallback.Next()
+			if !ok {
+				break
+			}
+			output = append(output, nick)
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%+v gave %q, wanted %q", test.fallback, output, test.output)
+		}
+	}
+}
+
+func TestNickRegainerMonitor(t *testing.T) {
+	r := NewNickRegainer("alice", "alice_")
+
+	tests := []struct {
+		input  Message
+		output []Message
+	}{
+		{
+			Message{Command: "005", Params: []string{"alice_", "CHANTYPES=#",
+				"are supported"}},
+			nil,
+		},
+		{
+			Message{Command: "005", Params: []string{"alice_", "MONITOR=100",
+				"are supported"}},
+			[]Message{{Command: "MONITOR", Params: []string{"+", "alice"}}},
+		},
+		{
+			Message{Command: "730", Params: []string{"alice_", "alice!u@h"}},
+			nil,
+		},
+		{
+			Message{Command: "731", Params: []string{"alice_", "bob,Alice"}},
+			[]Message{{Command: "NICK", Params: []string{"alice"}}},
+		},
+		{
+			Message{Prefix: "alice_!u@h", Command: "NICK",
+				Params: []string{"alice"}},
+			[]Message{{Command: "MONITOR", Params: []string{"-", "alice"}}},
+		},
+		{
+			Message{Command: "731", Params: []string{"alice", "alice"}},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		output := r.Handle(test.input)
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("Handle(%s) = %v, wanted %v", test.input, output, test.output)
+		}
+		if r.Monitoring() && len(r.Tick()) != 0 {
+			t.Errorf("Tick() while monitoring sent messages")
+		}
+	}
+
+	if !r.Regained() {
+		t.Errorf("Regained() = false, wanted true")
+	}
+}
+
+func TestNickRegainerPeriodic(t *testing.T) {
+	r := NewNickRegainer("alice", "alice_")
+	nick := []Message{{Command: "NICK", Params: []string{"alice"}}}
+
+	if output := r.Tick(); !reflect.DeepEqual(output, nick) {
+		t.Errorf("Tick() = %v, wanted %v", output, nick)
+	}
+
+	// The holder leaves, so we ask right away.
+	quit := Message{Prefix: "alice!u@h", Command: "QUIT",
+		Params: []string{"bye"}}
+	if output := r.Handle(quit); !reflect.DeepEqual(output, nick) {
+		t.Errorf("Handle(%s) = %v, wanted %v", quit, output, nick)
+	}
+
+	// The list is full, so we keep asking periodically.
+	r = NewNickRegainer("alice", "alice_")
+	r.Handle(Message{Command: "005", Params: []string{"alice_", "MONITOR",
+		"are supported"}})
+	r.Handle(Message{Command: "734", Params: []string{"alice_", "100",
+		"alice", "Monitor list is full"}})
+	if output := r.Tick(); !reflect.DeepEqual(output, nick) {
+		t.Errorf("Tick() after 734 = %v, wanted %v", output, nick)
+	}
+
+	r.Handle(Message{Prefix: "alice_!u@h", Command: "NICK",
+		Params: []string{"alice"}})
+	if output := r.Tick(); output != nil {
+		t.Errorf("Tick() after regaining = %v, wanted nil", output)
+	}
+}
+
+func TestISupportToken(t *testing.T) {
+	m := Message{Command: "005", Params: []string{"alice", "MONITOR=100",
+		"WHOX", "are supported by this server"}}
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"MONITOR", "100", true},
+		{"whox", "", true},
+		{"CHATHISTORY", "", false},
+		{"are supported by this server", "", false},
+	}
+
+	for _, test := range tests {
+		value, ok := isupportToken(m, test.name)
+		if value != test.value || ok != test.ok {
+			t.Errorf("isupportToken(%s) = %q, %v, wanted %q, %v", test.name, value,
+				ok, test.value, test.ok)
+		}
+	}
+}
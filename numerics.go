@@ -0,0 +1,239 @@
+package irc
+
+// Numeric replies. See RFC 1459/2812 and https://modern.ircdocs.horse.
+const (
+	// ReplyWelcome is the RPL_WELCOME response numeric.
+	ReplyWelcome = "001"
+
+	// ReplyISupport is the RPL_ISUPPORT response numeric.
+	ReplyISupport = "005"
+
+	// ReplyEndOfStats is the RPL_ENDOFSTATS response numeric.
+	ReplyEndOfStats = "219"
+
+	// ReplyWhoisCertFP is the RPL_WHOISCERTFP response numeric.
+	ReplyWhoisCertFP = "276"
+
+	// ReplyAway is the RPL_AWAY response numeric.
+	ReplyAway = "301"
+
+	// ReplyWhoisUser is the RPL_WHOISUSER response numeric.
+	ReplyWhoisUser = "311"
+
+	// ReplyWhoisServer is the RPL_WHOISSERVER response numeric.
+	ReplyWhoisServer = "312"
+
+	// ReplyWhoisOperator is the RPL_WHOISOPERATOR response numeric.
+	ReplyWhoisOperator = "313"
+
+	// ReplyEndOfWho is the RPL_ENDOFWHO response numeric.
+	ReplyEndOfWho = "315"
+
+	// ReplyWhoisIdle is the RPL_WHOISIDLE response numeric.
+	ReplyWhoisIdle = "317"
+
+	// ReplyEndOfWhois is the RPL_ENDOFWHOIS response numeric.
+	ReplyEndOfWhois = "318"
+
+	// ReplyWhoisChannels is the RPL_WHOISCHANNELS response numeric.
+	ReplyWhoisChannels = "319"
+
+	// ReplyListStart is the RPL_LISTSTART response numeric.
+	ReplyListStart = "321"
+
+	// ReplyList is the RPL_LIST response numeric.
+	ReplyList = "322"
+
+	// ReplyListEnd is the RPL_LISTEND response numeric.
+	ReplyListEnd = "323"
+
+	// ReplyWhoisAccount is the RPL_WHOISACCOUNT response numeric.
+	ReplyWhoisAccount = "330"
+
+	// ReplyWhoisActually is the RPL_WHOISACTUALLY response numeric.
+	ReplyWhoisActually = "338"
+
+	// ReplyInviteList is the RPL_INVITELIST response numeric.
+	ReplyInviteList = "346"
+
+	// ReplyEndOfInviteList is the RPL_ENDOFINVITELIST response numeric.
+	ReplyEndOfInviteList = "347"
+
+	// ReplyExceptList is the RPL_EXCEPTLIST response numeric.
+	ReplyExceptList = "348"
+
+	// ReplyEndOfExceptList is the RPL_ENDOFEXCEPTLIST response numeric.
+	ReplyEndOfExceptList = "349"
+
+	// ReplyWhoReply is the RPL_WHOREPLY response numeric.
+	ReplyWhoReply = "352"
+
+	// ReplyNamReply is the RPL_NAMREPLY response numeric.
+	ReplyNamReply = "353"
+
+	// ReplyWhoSpcRpl is the RPL_WHOSPCRPL response numeric. It is the reply to
+	// a WHOX query.
+	ReplyWhoSpcRpl = "354"
+
+	// ReplyLinks is the RPL_LINKS response numeric.
+	ReplyLinks = "364"
+
+	// ReplyEndOfLinks is the RPL_ENDOFLINKS response numeric.
+	ReplyEndOfLinks = "365"
+
+	// ReplyEndOfNames is the RPL_ENDOFNAMES response numeric.
+	ReplyEndOfNames = "366"
+
+	// ReplyBanList is the RPL_BANLIST response numeric.
+	ReplyBanList = "367"
+
+	// ReplyEndOfBanList is the RPL_ENDOFBANLIST response numeric.
+	ReplyEndOfBanList = "368"
+
+	// ReplyInfo is the RPL_INFO response numeric.
+	ReplyInfo = "371"
+
+	// ReplyMOTD is the RPL_MOTD response numeric.
+	ReplyMOTD = "372"
+
+	// ReplyInfoStart is the RPL_INFOSTART response numeric.
+	ReplyInfoStart = "373"
+
+	// ReplyEndOfInfo is the RPL_ENDOFINFO response numeric.
+	ReplyEndOfInfo = "374"
+
+	// ReplyMOTDStart is the RPL_MOTDSTART response numeric.
+	ReplyMOTDStart = "375"
+
+	// ReplyEndOfMOTD is the RPL_ENDOFMOTD response numeric.
+	ReplyEndOfMOTD = "376"
+
+	// ReplyYoureOper is the RPL_YOUREOPER response numeric.
+	ReplyYoureOper = "381"
+
+	// ErrorNoSuchNick is the ERR_NOSUCHNICK error numeric.
+	ErrorNoSuchNick = "401"
+
+	// ErrorNoSuchServer is the ERR_NOSUCHSERVER error numeric.
+	ErrorNoSuchServer = "402"
+
+	// ErrorNoSuchChannel is the ERR_NOSUCHCHANNEL error numeric.
+	ErrorNoSuchChannel = "403"
+
+	// ErrorCannotSendToChan is the ERR_CANNOTSENDTOCHAN error numeric.
+	ErrorCannotSendToChan = "404"
+
+	// ErrorTooManyChannels is the ERR_TOOMANYCHANNELS error numeric.
+	ErrorTooManyChannels = "405"
+
+	// ErrorInvalidCapCmd is the ERR_INVALIDCAPCMD error numeric.
+	ErrorInvalidCapCmd = "410"
+
+	// ErrorUnknownCommand is the ERR_UNKNOWNCOMMAND error numeric.
+	ErrorUnknownCommand = "421"
+
+	// ErrorNoMOTD is the ERR_NOMOTD error numeric.
+	ErrorNoMOTD = "422"
+
+	// ErrorNoNicknameGiven is the ERR_NONICKNAMEGIVEN error numeric.
+	ErrorNoNicknameGiven = "431"
+
+	// ErrorErroneusNickname is the ERR_ERRONEUSNICKNAME error numeric.
+	ErrorErroneusNickname = "432"
+
+	// ErrorNicknameInUse is the ERR_NICKNAMEINUSE error numeric.
+	ErrorNicknameInUse = "433"
+
+	// ErrorNickCollision is the ERR_NICKCOLLISION error numeric.
+	ErrorNickCollision = "436"
+
+	// ErrorUnavailResource is the ERR_UNAVAILRESOURCE error numeric.
+	ErrorUnavailResource = "437"
+
+	// ErrorUserNotInChannel is the ERR_USERNOTINCHANNEL error numeric.
+	ErrorUserNotInChannel = "441"
+
+	// ErrorNotOnChannel is the ERR_NOTONCHANNEL error numeric.
+	ErrorNotOnChannel = "442"
+
+	// ErrorUserOnChannel is the ERR_USERONCHANNEL error numeric.
+	ErrorUserOnChannel = "443"
+
+	// ErrorNotRegistered is the ERR_NOTREGISTERED error numeric.
+	ErrorNotRegistered = "451"
+
+	// ErrorNeedMoreParams is the ERR_NEEDMOREPARAMS error numeric.
+	ErrorNeedMoreParams = "461"
+
+	// ErrorAlreadyRegistered is the ERR_ALREADYREGISTERED error numeric.
+	ErrorAlreadyRegistered = "462"
+
+	// ErrorPasswdMismatch is the ERR_PASSWDMISMATCH error numeric.
+	ErrorPasswdMismatch = "464"
+
+	// ErrorYoureBannedCreep is the ERR_YOUREBANNEDCREEP error numeric.
+	ErrorYoureBannedCreep = "465"
+
+	// ErrorChannelIsFull is the ERR_CHANNELISFULL error numeric.
+	ErrorChannelIsFull = "471"
+
+	// ErrorInviteOnlyChan is the ERR_INVITEONLYCHAN error numeric.
+	ErrorInviteOnlyChan = "473"
+
+	// ErrorBannedFromChan is the ERR_BANNEDFROMCHAN error numeric.
+	ErrorBannedFromChan = "474"
+
+	// ErrorBadChannelKey is the ERR_BADCHANNELKEY error numeric.
+	ErrorBadChannelKey = "475"
+
+	// ErrorNoPrivileges is the ERR_NOPRIVILEGES error numeric.
+	ErrorNoPrivileges = "481"
+
+	// ErrorChanOPrivsNeeded is the ERR_CHANOPRIVSNEEDED error numeric.
+	ErrorChanOPrivsNeeded = "482"
+
+	// ReplyWhoisSecure is the RPL_WHOISSECURE response numeric.
+	ReplyWhoisSecure = "671"
+
+	// ReplyMonOnline is the RPL_MONONLINE response numeric.
+	ReplyMonOnline = "730"
+
+	// ReplyMonOffline is the RPL_MONOFFLINE response numeric.
+	ReplyMonOffline = "731"
+
+	// ReplyMonList is the RPL_MONLIST response numeric.
+	ReplyMonList = "732"
+
+	// ReplyEndOfMonList is the RPL_ENDOFMONLIST response numeric.
+	ReplyEndOfMonList = "733"
+
+	// ErrorMonListFull is the ERR_MONLISTFULL error numeric.
+	ErrorMonListFull = "734"
+
+	// ReplyLoggedIn is the RPL_LOGGEDIN response numeric.
+	ReplyLoggedIn = "900"
+
+	// ReplyLoggedOut is the RPL_LOGGEDOUT response numeric.
+	ReplyLoggedOut = "901"
+
+	// ErrorNickLocked is the ERR_NICKLOCKED error numeric.
+	ErrorNickLocked = "902"
+
+	// ReplySASLSuccess is the RPL_SASLSUCCESS response numeric.
+	ReplySASLSuccess = "903"
+
+	// ErrorSASLFail is the ERR_SASLFAIL error numeric.
+	ErrorSASLFail = "904"
+
+	// ErrorSASLTooLong is the ERR_SASLTOOLONG error numeric.
+	ErrorSASLTooLong = "905"
+
+	// ErrorSASLAborted is the ERR_SASLABORTED error numeric.
+	ErrorSASLAborted = "906"
+
+	// ErrorSASLAlready is the ERR_SASLALREADY error numeric.
+	ErrorSASLAlready = "907"
+
+	// ReplySASLMechs is the RPL_SASLMECHS response numeric.
+	ReplySASLMechs = "908"
+)
@@ -0,0 +1,158 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeMode controls what Sanitize does with unsafe characters.
+type SanitizeMode int
+
+const (
+	// SanitizeEscape replaces unsafe characters with Go style escape sequences
+	// such as \x1b and \u202e. Backslashes are not escaped, so the result is for
+	// display only and can't be reliably unescaped.
+	SanitizeEscape SanitizeMode = iota
+
+	// SanitizeDrop removes unsafe characters.
+	SanitizeDrop
+
+	// SanitizeVisible replaces C0 control characters and DEL with their
+	// symbols from the Unicode Control Pictures block (for example U+241B for
+	// ESC), and other unsafe characters with <U+XXXX>. Invalid UTF-8 becomes
+	// U+FFFD.
+	SanitizeVisible
+)
+
+// Sanitizer makes text safe to write to a terminal or a log.
+//
+// Text from IRC can contain anything other than NUL, CR, and LF. If written
+// to a terminal as is, ANSI escape sequences and other control characters can
+// change what the terminal shows, and bidirectional override characters can
+// make text appear in a misleading order.
+//
+// We consider these characters unsafe:
+//
+//   - C0 control characters (0x00-0x1f) and DEL (0x7f)
+//   - C1 control characters (U+0080-U+009F)
+//   - Bidirectional formatting characters, such as U+202E
+//   - The Unicode line and paragraph separators (U+2028, U+2029)
+//   - Bytes that are not valid UTF-8
+//
+// This is separate from handling IRC formatting codes (see the format
+// package). Those codes are C0 control characters, so by default they are
+// treated as unsafe too.
+type Sanitizer struct {
+	Mode SanitizeMode
+
+	// KeepFormatting leaves IRC formatting codes (bold, colour, and so on) in
+	// place. These are not interpreted by terminals, so this is useful if you
+	// want to render them later.
+	KeepFormatting bool
+}
+
+// Sanitize makes the text safe to display using the given mode.
+//
+// IRC formatting codes are treated as unsafe. Use a Sanitizer to keep them.
+func Sanitize(text string, mode SanitizeMode) string {
+	return Sanitizer{Mode: mode}.Sanitize(text)
+}
+
+// Sanitize makes the text safe to display.
+func (s Sanitizer) Sanitize(text string) string {
+	if s.isSafe(text) {
+		return text
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if r == utf8.RuneError && size == 1 {
+			switch s.Mode {
+			case SanitizeEscape:
+				fmt.Fprintf(&b, `\x%02x`, text[i])
+			case SanitizeVisible:
+				b.WriteRune(utf8.RuneError)
+			}
+			i++
+			continue
+		}
+
+		if !s.isUnsafe(r) {
+			b.WriteString(text[i : i+size])
+			i += size
+			continue
+		}
+
+		switch s.Mode {
+		case SanitizeEscape:
+			if r < 0x100 {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		case SanitizeVisible:
+			switch {
+			case r < 0x20:
+				b.WriteRune(0x2400 + r)
+			case r == 0x7f:
+				b.WriteRune(0x2421)
+			default:
+				fmt.Fprintf(&b, "<U+%04X>", r)
+			}
+		}
+
+		i += size
+	}
+
+	return b.String()
+}
+
+// isSafe returns true if there is nothing to change in the text.
+func (s Sanitizer) isSafe(text string) bool {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			return false
+		}
+		if s.isUnsafe(r) {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+func (s Sanitizer) isUnsafe(r rune) bool {
+	if s.KeepFormatting && isFormattingCode(r) {
+		return false
+	}
+
+	switch {
+	case r < 0x20, r == 0x7f:
+		return true
+	case r >= 0x80 && r <= 0x9f:
+		return true
+	}
+
+	switch r {
+	case '\u061c', '\u200e', '\u200f', '\u202a', '\u202b', '\u202c', '\u202d',
+		'\u202e', '\u2066', '\u2067', '\u2068', '\u2069', '\u2028', '\u2029':
+		return true
+	}
+
+	return false
+}
+
+// isFormattingCode returns true if the character is one of the IRC
+// formatting codes.
+func isFormattingCode(r rune) bool {
+	switch r {
+	case '\x02', '\x03', '\x04', '\x0f', '\x11', '\x16', '\x1d', '\x1e', '\x1f':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package sasl
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/horgh/irc"
+)
+
+// ChunkSize is the maximum length of the base64 payload in a single
+// AUTHENTICATE message. Longer payloads are split across several messages.
+const ChunkSize = 400
+
+// MaxPayloadLength is the maximum length of a base64 payload we accept when
+// reassembling.
+const MaxPayloadLength = 8192
+
+// ErrPayloadTooLong is the error Buffer returns when a payload exceeds
+// MaxPayloadLength.
+var ErrPayloadTooLong = errors.New("payload is too long")
+
+// Authenticate creates the AUTHENTICATE messages carrying a payload.
+//
+// We base64 encode the payload and split it into ChunkSize pieces. If the last
+// piece is exactly ChunkSize long, or the payload is empty, we follow it with
+// "AUTHENTICATE +".
+func Authenticate(payload []byte) []irc.Message {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	var msgs []irc.Message
+	for len(encoded) >= ChunkSize {
+		msgs = append(msgs, authenticate(encoded[:ChunkSize]))
+		encoded = encoded[ChunkSize:]
+	}
+
+	if encoded == "" {
+		encoded = "+"
+	}
+	return append(msgs, authenticate(encoded))
+}
+
+// Abort returns the message to abort authentication.
+func Abort() irc.Message {
+	return authenticate("*")
+}
+
+func authenticate(param string) irc.Message {
+	return irc.Message{Command: "AUTHENTICATE", Params: []string{param}}
+}
+
+// Buffer reassembles a payload sent in AUTHENTICATE chunks.
+//
+// The zero value is ready to use.
+type Buffer struct {
+	encoded strings.Builder
+}
+
+// Add adds the parameter of an AUTHENTICATE message.
+//
+// When the payload is complete we return it decoded and true. We reset the
+// buffer at that point so it is ready for the next payload.
+//
+// We return an error if the payload grows beyond MaxPayloadLength or is not
+// valid base64. The buffer is reset in that case as well.
+func (b *Buffer) Add(param string) ([]byte, bool, error) {
+	if param != "+" {
+		if b.encoded.Len()+len(param) > MaxPayloadLength {
+			b.encoded.Reset()
+			return nil, true, ErrPayloadTooLong
+		}
+		b.encoded.WriteString(param)
+
+		if len(param) == ChunkSize {
+			return nil, false, nil
+		}
+	}
+
+	encoded := b.encoded.String()
+	b.encoded.Reset()
+
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid base64: %s", err)
+	}
+	return payload, true, nil
+}
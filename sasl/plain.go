@@ -0,0 +1,54 @@
+package sasl
+
+import "fmt"
+
+// Plain is the PLAIN mechanism (RFC 4616).
+//
+// Only use it over a secure connection since it sends the password.
+type Plain struct {
+	// Identity is the identity to act as. It is usually blank, meaning the
+	// same as Username.
+	Identity string
+
+	Username string
+	Password string
+}
+
+// Name returns the mechanism's name.
+func (p *Plain) Name() string {
+	return "PLAIN"
+}
+
+// Start returns the initial response: identity, username, and password
+// separated by NUL.
+func (p *Plain) Start() ([]byte, error) {
+	return []byte(p.Identity + "\x00" + p.Username + "\x00" + p.Password), nil
+}
+
+// Next is not expected to be called. PLAIN has only the initial response.
+func (p *Plain) Next(challenge []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected challenge")
+}
+
+// External is the EXTERNAL mechanism (RFC 4422). The server authenticates us
+// by some external means, typically a TLS client certificate.
+type External struct {
+	// Identity is the identity to act as. It is usually blank, meaning the
+	// identity the server derives from the certificate.
+	Identity string
+}
+
+// Name returns the mechanism's name.
+func (e *External) Name() string {
+	return "EXTERNAL"
+}
+
+// Start returns the initial response, which is the identity.
+func (e *External) Start() ([]byte, error) {
+	return []byte(e.Identity), nil
+}
+
+// Next is not expected to be called. EXTERNAL has only the initial response.
+func (e *External) Next(challenge []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected challenge")
+}
@@ -0,0 +1,159 @@
+// Package sasl provides SASL authentication for IRC.
+//
+// See https://ircv3.net/specs/extensions/sasl-3.1 and
+// https://ircv3.net/specs/extensions/sasl-3.2.
+package sasl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/horgh/irc"
+)
+
+// Mechanism is the client side of a SASL mechanism.
+type Mechanism interface {
+	// Name is the mechanism's name, such as PLAIN.
+	Name() string
+
+	// Start returns the initial response.
+	Start() ([]byte, error)
+
+	// Next processes a challenge from the server and returns our response.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// Client authenticates to a server using a mechanism.
+//
+// It does no I/O. Send the message from Start, then give it each message from
+// the server with Handle and send the messages it returns. This must happen
+// after the sasl capability is enabled and before negotiation ends. See
+// irc.CapNegotiator's Hold and Release.
+//
+// It is not safe for concurrent use.
+type Client struct {
+	mech Mechanism
+
+	started bool
+	buf     Buffer
+
+	// mechErr is set if the mechanism failed and we aborted.
+	mechErr error
+
+	done       bool
+	success    bool
+	account    string
+	mechanisms []string
+}
+
+// NewClient creates a Client that uses the mechanism.
+func NewClient(mech Mechanism) *Client {
+	return &Client{mech: mech}
+}
+
+// Start returns the message that begins authentication.
+func (c *Client) Start() irc.Message {
+	return irc.Message{Command: "AUTHENTICATE", Params: []string{c.mech.Name()}}
+}
+
+// Done returns true once authentication finished, whether it succeeded or
+// not.
+func (c *Client) Done() bool {
+	return c.done
+}
+
+// Success returns true if we authenticated.
+func (c *Client) Success() bool {
+	return c.success
+}
+
+// Account returns the account we are logged in as. The server tells us this
+// with RPL_LOGGEDIN. It is blank if we are not logged in.
+func (c *Client) Account() string {
+	return c.account
+}
+
+// Mechanisms returns the mechanisms the server said it supports. It tells us
+// this with RPL_SASLMECHS if we choose a mechanism it does not support.
+func (c *Client) Mechanisms() []string {
+	return c.mechanisms
+}
+
+// Handle processes a message from the server. It returns the messages to send
+// in response, if any. Unrelated messages are ignored.
+//
+// When authentication fails we return an error. If the server rejected us
+// it is an *irc.NumericError. If the mechanism failed, such as because the
+// server could not prove it knows our password, we abort authentication and
+// return the mechanism's error once the server acknowledges that.
+func (c *Client) Handle(m irc.Message) ([]irc.Message, error) {
+	switch m.Command {
+	case "AUTHENTICATE":
+		return c.authenticate(m)
+	case irc.ReplyLoggedIn:
+		// <nick> <nick>!<ident>@<host> <account> :You are now logged in as ...
+		if len(m.Params) < 3 {
+			return nil, fmt.Errorf("malformed RPL_LOGGEDIN: %s", m)
+		}
+		c.account = m.Params[2]
+		return nil, nil
+	case irc.ReplyLoggedOut:
+		c.account = ""
+		return nil, nil
+	case irc.ReplySASLMechs:
+		// <nick> <mechanisms> :are available SASL mechanisms
+		if len(m.Params) < 2 {
+			return nil, fmt.Errorf("malformed RPL_SASLMECHS: %s", m)
+		}
+		c.mechanisms = strings.Split(m.Params[1], ",")
+		return nil, nil
+	case irc.ReplySASLSuccess:
+		c.done = true
+		c.success = true
+		return nil, nil
+	case irc.ErrorNickLocked, irc.ErrorSASLFail, irc.ErrorSASLTooLong,
+		irc.ErrorSASLAborted, irc.ErrorSASLAlready:
+		c.done = true
+		if c.mechErr != nil {
+			return nil, fmt.Errorf("%s: %s", c.mech.Name(), c.mechErr)
+		}
+		return nil, irc.NewNumericError(m)
+	default:
+		return nil, nil
+	}
+}
+
+// authenticate processes an AUTHENTICATE message carrying a challenge.
+func (c *Client) authenticate(m irc.Message) ([]irc.Message, error) {
+	if c.done || c.mechErr != nil {
+		return nil, nil
+	}
+
+	if len(m.Params) == 0 {
+		return nil, fmt.Errorf("malformed AUTHENTICATE: %s", m)
+	}
+
+	challenge, complete, err := c.buf.Add(m.Params[0])
+	if err != nil {
+		c.mechErr = err
+		return []irc.Message{Abort()}, nil
+	}
+	if !complete {
+		return nil, nil
+	}
+
+	// The first challenge is empty. It tells us to send the initial response.
+	var response []byte
+	if !c.started {
+		c.started = true
+		response, err = c.mech.Start()
+	} else {
+		response, err = c.mech.Next(challenge)
+	}
+	if err != nil {
+		c.mechErr = err
+		return []irc.Message{Abort()}, nil
+	}
+
+	return Authenticate(response), nil
+}
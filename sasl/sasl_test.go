@@ -0,0 +1,215 @@
+package sasl
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/horgh/irc"
+)
+
+// scriptStep is a message from a fake server and the lines we expect the
+// client to send in response.
+type scriptStep struct {
+	server string
+	client []string
+}
+
+// runScript plays the steps against the client. It returns the error from
+// the last step.
+func runScript(t *testing.T, c *Client, steps []scriptStep) error {
+	var lastErr error
+	for _, step := range steps {
+		m, err := irc.ParseMessage(step.server)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", step.server, err)
+		}
+
+		msgs, err := c.Handle(m)
+		lastErr = err
+
+		var got []string
+		for _, msg := range msgs {
+			buf, err := msg.Encode()
+			if err != nil {
+				t.Fatalf("Encode(%s) = %s", msg, err)
+			}
+			got = append(got, buf)
+		}
+
+		if !reflect.DeepEqual(got, step.client) {
+			t.Fatalf("Handle(%q) sent %q, wanted %q", step.server, got, step.client)
+		}
+	}
+	return lastErr
+}
+
+func TestClientPlain(t *testing.T) {
+	c := NewClient(&Plain{Username: "alice", Password: "secret"})
+
+	start, err := c.Start().Encode()
+	if err != nil || start != "AUTHENTICATE PLAIN\r\n" {
+		t.Fatalf("Start() = %q, %v, wanted AUTHENTICATE PLAIN", start, err)
+	}
+
+	err = runScript(t, c, []scriptStep{
+		{"AUTHENTICATE +\r\n", []string{"AUTHENTICATE AGFsaWNlAHNlY3JldA==\r\n"}},
+		{":irc 900 alice alice!a@h alice :You are now logged in as alice\r\n", nil},
+		{":irc 903 alice :SASL authentication successful\r\n", nil},
+	})
+	if err != nil {
+		t.Fatalf("authentication failed: %s", err)
+	}
+
+	if !c.Done() || !c.Success() || c.Account() != "alice" {
+		t.Errorf("Done() = %v, Success() = %v, Account() = %s", c.Done(),
+			c.Success(), c.Account())
+	}
+}
+
+func TestClientExternal(t *testing.T) {
+	c := NewClient(&External{})
+
+	err := runScript(t, c, []scriptStep{
+		{"AUTHENTICATE +\r\n", []string{"AUTHENTICATE +\r\n"}},
+		{":irc 903 alice :SASL authentication successful\r\n", nil},
+	})
+	if err != nil {
+		t.Fatalf("authentication failed: %s", err)
+	}
+}
+
+func TestClientFail(t *testing.T) {
+	c := NewClient(&Plain{Username: "alice", Password: "wrong"})
+
+	err := runScript(t, c, []scriptStep{
+		{"AUTHENTICATE +\r\n", []string{"AUTHENTICATE AGFsaWNlAHdyb25n\r\n"}},
+		{":irc 904 alice :SASL authentication failed\r\n", nil},
+	})
+
+	var numErr *irc.NumericError
+	if !errors.As(err, &numErr) || numErr.Message.Command != irc.ErrorSASLFail {
+		t.Fatalf("got error %v, wanted ERR_SASLFAIL", err)
+	}
+	if !c.Done() || c.Success() {
+		t.Errorf("Done() = %v, Success() = %v", c.Done(), c.Success())
+	}
+}
+
+func TestClientUnsupportedMechanism(t *testing.T) {
+	c := NewClient(NewScramSHA256("alice", "secret"))
+
+	err := runScript(t, c, []scriptStep{
+		{":irc 908 alice PLAIN,EXTERNAL :are available SASL mechanisms\r\n", nil},
+		{":irc 904 alice :SASL authentication failed\r\n", nil},
+	})
+	if err == nil {
+		t.Fatalf("authentication succeeded")
+	}
+
+	if want := []string{"PLAIN", "EXTERNAL"}; !reflect.DeepEqual(c.Mechanisms(),
+		want) {
+		t.Errorf("Mechanisms() = %q, wanted %q", c.Mechanisms(), want)
+	}
+}
+
+func TestClientScramSHA256(t *testing.T) {
+	// The example from RFC 7677.
+	mech := NewScramSHA256("user", "pencil")
+	mech.nonce = func() (string, error) { return "rOprNGfwEbeRWgbNEkqO", nil }
+
+	c := NewClient(mech)
+
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	err := runScript(t, c, []scriptStep{
+		{"AUTHENTICATE +\r\n", []string{
+			"AUTHENTICATE " + encode("n,,n=user,r=rOprNGfwEbeRWgbNEkqO") + "\r\n"}},
+		{"AUTHENTICATE " + encode("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096") + "\r\n",
+			[]string{"AUTHENTICATE " + encode("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=") + "\r\n"}},
+		{"AUTHENTICATE " + encode("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=") + "\r\n",
+			[]string{"AUTHENTICATE +\r\n"}},
+		{":irc 903 user :SASL authentication successful\r\n", nil},
+	})
+	if err != nil {
+		t.Fatalf("authentication failed: %s", err)
+	}
+}
+
+func TestClientScramBadServerSignature(t *testing.T) {
+	mech := NewScramSHA256("user", "pencil")
+	mech.nonce = func() (string, error) { return "rOprNGfwEbeRWgbNEkqO", nil }
+
+	c := NewClient(mech)
+
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	err := runScript(t, c, []scriptStep{
+		{"AUTHENTICATE +\r\n", []string{
+			"AUTHENTICATE " + encode("n,,n=user,r=rOprNGfwEbeRWgbNEkqO") + "\r\n"}},
+		{"AUTHENTICATE " + encode("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096") + "\r\n",
+			[]string{"AUTHENTICATE " + encode("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=") + "\r\n"}},
+		// A server that does not know the password can't produce this.
+		{"AUTHENTICATE " + encode("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=") + "\r\n",
+			[]string{"AUTHENTICATE *\r\n"}},
+		{":irc 906 user :SASL authentication aborted\r\n", nil},
+	})
+	if err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("got error %v, wanted a signature error", err)
+	}
+	if c.Success() {
+		t.Errorf("Success() = true")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		lengths []int
+	}{
+		{nil, []int{1}},
+		{[]byte("abc"), []int{4}},
+		// 300 bytes encode to exactly 400 so we need a + after.
+		{make([]byte, 300), []int{400, 1}},
+		{make([]byte, 301), []int{400, 4}},
+		{make([]byte, 700), []int{400, 400, 136}},
+	}
+
+	for _, test := range tests {
+		msgs := Authenticate(test.payload)
+
+		var lengths []int
+		var buf Buffer
+		var got []byte
+		for i, m := range msgs {
+			lengths = append(lengths, len(m.Params[0]))
+
+			payload, done, err := buf.Add(m.Params[0])
+			if err != nil {
+				t.Fatalf("Add(%q) = %s", m.Params[0], err)
+			}
+			if done != (i == len(msgs)-1) {
+				t.Fatalf("Add(%q) done = %v at chunk %d of %d", m.Params[0], done,
+					i+1, len(msgs))
+			}
+			got = payload
+		}
+
+		if !reflect.DeepEqual(lengths, test.lengths) {
+			t.Errorf("Authenticate(%d bytes) chunk lengths = %v, wanted %v",
+				len(test.payload), lengths, test.lengths)
+		}
+
+		if len(got) != len(test.payload) ||
+			(len(got) > 0 && !reflect.DeepEqual(got, test.payload)) {
+			t.Errorf("reassembled %d bytes, wanted %d", len(got),
+				len(test.payload))
+		}
+	}
+}
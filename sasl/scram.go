@@ -0,0 +1,282 @@
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// MaxScramIterations is the largest iteration count we accept from a server.
+// Computing the salted password takes time proportional to the count, so a
+// hostile server could otherwise keep us busy for a long time.
+const MaxScramIterations = 1 << 20
+
+// Scram is a SCRAM mechanism (RFC 5802), such as SCRAM-SHA-256 (RFC 7677).
+//
+// We do not support channel binding. We do not apply SASLprep to the
+// username or password, so they should be ASCII.
+type Scram struct {
+	name     string
+	hash     func() hash.Hash
+	username string
+	password string
+
+	// Identity is the identity to act as. It is usually blank.
+	Identity string
+
+	// nonce generates the client nonce. We replace it in tests.
+	nonce func() (string, error)
+
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	gs2Header       string
+	serverSignature []byte
+}
+
+// NewScramSHA1 creates a SCRAM-SHA-1 mechanism.
+func NewScramSHA1(username, password string) *Scram {
+	return newScram("SCRAM-SHA-1", sha1.New, username, password)
+}
+
+// NewScramSHA256 creates a SCRAM-SHA-256 mechanism.
+func NewScramSHA256(username, password string) *Scram {
+	return newScram("SCRAM-SHA-256", sha256.New, username, password)
+}
+
+func newScram(name string, h func() hash.Hash, username,
+	password string) *Scram {
+	return &Scram{
+		name:     name,
+		hash:     h,
+		username: username,
+		password: password,
+		nonce:    randomNonce,
+	}
+}
+
+// Name returns the mechanism's name.
+func (s *Scram) Name() string {
+	return s.name
+}
+
+// Start returns the client-first-message.
+func (s *Scram) Start() ([]byte, error) {
+	nonce, err := s.nonce()
+	if err != nil {
+		return nil, fmt.Errorf("error generating nonce: %s", err)
+	}
+
+	s.gs2Header = "n,,"
+	if s.Identity != "" {
+		s.gs2Header = "n,a=" + escapeSaslname(s.Identity) + ","
+	}
+
+	s.clientNonce = nonce
+	s.clientFirstBare = "n=" + escapeSaslname(s.username) + ",r=" + nonce
+	s.step = 1
+
+	return []byte(s.gs2Header + s.clientFirstBare), nil
+}
+
+// Next processes the server-first-message and returns the
+// client-final-message, then processes the server-final-message and returns
+// an empty response.
+func (s *Scram) Next(challenge []byte) ([]byte, error) {
+	switch s.step {
+	case 1:
+		s.step++
+		return s.clientFinal(string(challenge))
+	case 2:
+		s.step++
+		return nil, s.verifyServerFinal(string(challenge))
+	default:
+		return nil, fmt.Errorf("unexpected challenge")
+	}
+}
+
+// clientFinal processes the server-first-message and creates the
+// client-final-message.
+//
+// server-first-message = [reserved-mext ","] nonce "," salt "," iteration-count
+// ["," extensions]
+func (s *Scram) clientFinal(serverFirst string) ([]byte, error) {
+	attrs, err := parseScramAttributes(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := attrs['m']; ok {
+		return nil, fmt.Errorf("unsupported mandatory extension")
+	}
+
+	nonce := attrs['r']
+	if !strings.HasPrefix(nonce, s.clientNonce) ||
+		len(nonce) == len(s.clientNonce) {
+		return nil, fmt.Errorf("server nonce does not extend our nonce")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("invalid salt")
+	}
+
+	iterations, err := strconv.Atoi(attrs['i'])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count")
+	}
+	if iterations > MaxScramIterations {
+		return nil, fmt.Errorf("iteration count %d exceeds %d", iterations,
+			MaxScramIterations)
+	}
+
+	saltedPassword := hi(s.hash, []byte(s.password), salt, iterations)
+	clientKey := hmacSum(s.hash, saltedPassword, "Client Key")
+	keys := newScramKeys(s.hash, saltedPassword, salt, iterations)
+
+	clientFinalWithoutProof := "c=" +
+		base64.StdEncoding.EncodeToString([]byte(s.gs2Header)) + ",r=" + nonce
+	authMessage := s.clientFirstBare + "," + serverFirst + "," +
+		clientFinalWithoutProof
+
+	clientSignature := hmacSum(s.hash, keys.StoredKey, authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	s.serverSignature = hmacSum(s.hash, keys.ServerKey, authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" +
+		base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the server-final-message proves the server knows
+// our password.
+//
+// server-final-message = (server-error / verifier) ["," extensions]
+func (s *Scram) verifyServerFinal(serverFinal string) error {
+	attrs, err := parseScramAttributes(serverFinal)
+	if err != nil {
+		return err
+	}
+
+	if e, ok := attrs['e']; ok {
+		return fmt.Errorf("server error: %s", e)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs['v'])
+	if err != nil {
+		return fmt.Errorf("invalid server signature")
+	}
+
+	if subtle.ConstantTimeCompare(signature, s.serverSignature) != 1 {
+		return fmt.Errorf("server signature does not match")
+	}
+
+	return nil
+}
+
+// ScramKeys are what a server needs to authenticate a user with SCRAM. They
+// are derived from the password but do not reveal it, and they are not enough
+// to authenticate as the user.
+type ScramKeys struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewScramKeys derives the SCRAM keys for a password.
+func NewScramKeys(h func() hash.Hash, password string, salt []byte,
+	iterations int) ScramKeys {
+	return newScramKeys(h, hi(h, []byte(password), salt, iterations), salt,
+		iterations)
+}
+
+// newScramKeys derives the SCRAM keys from the salted password.
+//
+// SaltedPassword  := Hi(Normalize(password), salt, i)
+// ClientKey       := HMAC(SaltedPassword, "Client Key")
+// StoredKey       := H(ClientKey)
+// ServerKey       := HMAC(SaltedPassword, "Server Key")
+func newScramKeys(h func() hash.Hash, saltedPassword, salt []byte,
+	iterations int) ScramKeys {
+	storedKey := h()
+	_, _ = storedKey.Write(hmacSum(h, saltedPassword, "Client Key"))
+
+	return ScramKeys{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey.Sum(nil),
+		ServerKey:  hmacSum(h, saltedPassword, "Server Key"),
+	}
+}
+
+// hi is the Hi function from RFC 5802. It is PBKDF2 with HMAC as the
+// pseudorandom function and an output length of the hash's size.
+func hi(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	mac := hmac.New(h, password)
+
+	var block [4]byte
+	binary.BigEndian.PutUint32(block[:], 1)
+	_, _ = mac.Write(salt)
+	_, _ = mac.Write(block[:])
+	u := mac.Sum(nil)
+
+	result := make([]byte, len(u))
+	copy(result, u)
+
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		_, _ = mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+
+	return result
+}
+
+func hmacSum(h func() hash.Hash, key []byte, message string) []byte {
+	mac := hmac.New(h, key)
+	_, _ = mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// parseScramAttributes parses a SCRAM message into its attributes. Each is a
+// single letter, '=', and a value, separated by commas.
+func parseScramAttributes(s string) (map[byte]string, error) {
+	attrs := map[byte]string{}
+	for _, field := range strings.Split(s, ",") {
+		if len(field) < 2 || field[1] != '=' {
+			return nil, fmt.Errorf("malformed attribute: %q", field)
+		}
+		attrs[field[0]] = field[2:]
+	}
+	return attrs, nil
+}
+
+// escapeSaslname escapes a username for SCRAM. '=' and ',' have special
+// meanings.
+func escapeSaslname(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+// randomNonce creates a client nonce.
+func randomNonce() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,83 @@
+package sasl
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"testing"
+)
+
+func TestScramSHA1(t *testing.T) {
+	// The example from RFC 5802.
+	s := NewScramSHA1("user", "pencil")
+	s.nonce = func() (string, error) { return "fyko+d2lbbFgONRv9qkxdawL", nil }
+
+	steps := []struct {
+		challenge string
+		response  string
+	}{
+		{"", "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL"},
+		{"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts="},
+		{"v=rmF9pqV8S7suAoZWja4dJRkFsKQ=", ""},
+	}
+
+	for i, step := range steps {
+		var response []byte
+		var err error
+		if i == 0 {
+			response, err = s.Start()
+		} else {
+			response, err = s.Next([]byte(step.challenge))
+		}
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		if string(response) != step.response {
+			t.Errorf("step %d: response %q, wanted %q", i, response, step.response)
+		}
+	}
+}
+
+func TestScramServerFirstChecks(t *testing.T) {
+	tests := []string{
+		// The nonce does not start with ours.
+		"r=abc,s=QSXCR+Q6sek8bf92,i=4096",
+		// The server added nothing to the nonce.
+		"r=fyko,s=QSXCR+Q6sek8bf92,i=4096",
+		"r=fykoX,s=,i=4096",
+		"r=fykoX,s=QSXCR+Q6sek8bf92,i=0",
+		// Too many iterations.
+		"r=fykoX,s=QSXCR+Q6sek8bf92,i=2147483647",
+		"r=fykoX,s=QSXCR+Q6sek8bf92,i=1048577",
+		"m=ext,r=fykoX,s=QSXCR+Q6sek8bf92,i=4096",
+		"garbage",
+	}
+
+	for _, test := range tests {
+		s := NewScramSHA1("user", "pencil")
+		s.nonce = func() (string, error) { return "fyko", nil }
+		if _, err := s.Start(); err != nil {
+			t.Fatalf("Start() = %s", err)
+		}
+
+		if _, err := s.Next([]byte(test)); err == nil {
+			t.Errorf("Next(%q) succeeded, wanted error", test)
+		}
+	}
+}
+
+func TestHi(t *testing.T) {
+	salt, err := base64.StdEncoding.DecodeString("QSXCR+Q6sek8bf92")
+	if err != nil {
+		t.Fatalf("decoding salt: %s", err)
+	}
+
+	// From the RFC 5802 example: SaltedPassword is
+	// 1d96ee3a529b5a5f9e47c01f229a2cb8a6e15f7d.
+	want := "HZbuOlKbWl+eR8AfIposuKbhX30="
+	got := base64.StdEncoding.EncodeToString(hi(sha1.New, []byte("pencil"), salt,
+		4096))
+	if got != want {
+		t.Errorf("hi() = %s, wanted %s", got, want)
+	}
+}
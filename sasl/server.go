@@ -0,0 +1,415 @@
+package sasl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/horgh/irc"
+)
+
+// ServerMechanism is the server side of a SASL mechanism.
+type ServerMechanism interface {
+	// Next processes a response from the client and returns the next
+	// challenge. When the client has authenticated it returns true and the
+	// account.
+	Next(response []byte) ([]byte, bool, string, error)
+}
+
+// ServerMechanisms maps mechanism names to functions creating them. These
+// are the mechanisms a Server offers by default.
+var ServerMechanisms = map[string]func(AccountStore) ServerMechanism{
+	"PLAIN": func(store AccountStore) ServerMechanism {
+		return &plainServer{store: store}
+	},
+	"SCRAM-SHA-256": func(store AccountStore) ServerMechanism {
+		return newScramServer(sha256.New, store)
+	},
+}
+
+// Server authenticates a single client connection.
+//
+// It does no I/O. Give it each AUTHENTICATE command the client sends with
+// Handle and send the client the messages it returns. Clients may only
+// authenticate once they enable the sasl capability.
+//
+// It is not safe for concurrent use.
+type Server struct {
+	store      AccountStore
+	serverName string
+	mechs      map[string]func(AccountStore) ServerMechanism
+
+	mech    ServerMechanism
+	buf     Buffer
+	account string
+}
+
+// NewServer creates a Server that looks up accounts in the store. serverName
+// is used as the prefix of replies.
+func NewServer(store AccountStore, serverName string) *Server {
+	return &Server{
+		store:      store,
+		serverName: serverName,
+		mechs:      ServerMechanisms,
+	}
+}
+
+// Mechanisms returns the names of the mechanisms we offer, sorted and joined
+// with commas. This is the value of the sasl capability.
+func (s *Server) Mechanisms() string {
+	var names []string
+	for name := range s.mechs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Account returns the account the client authenticated as. It is blank if it
+// has not.
+func (s *Server) Account() string {
+	return s.account
+}
+
+// Handle processes an AUTHENTICATE command from the client. It returns the
+// replies to send.
+//
+// nick is the client's nick, or "*" if it does not have one yet. mask is its
+// nick!user@host.
+func (s *Server) Handle(m irc.Message, nick, mask string) ([]irc.Message,
+	error) {
+	if m.Command != "AUTHENTICATE" {
+		return nil, fmt.Errorf("not an AUTHENTICATE command: %s", m.Command)
+	}
+
+	if nick == "" {
+		nick = "*"
+	}
+
+	if len(m.Params) == 0 {
+		return []irc.Message{s.reply(irc.ErrorNeedMoreParams, nick,
+			"AUTHENTICATE", "Not enough parameters")}, nil
+	}
+	param := m.Params[0]
+
+	if s.account != "" {
+		return []irc.Message{s.reply(irc.ErrorSASLAlready, nick,
+			"You have already authenticated using SASL")}, nil
+	}
+
+	if param == "*" {
+		s.reset()
+		return []irc.Message{s.reply(irc.ErrorSASLAborted, nick,
+			"SASL authentication aborted")}, nil
+	}
+
+	// The first AUTHENTICATE names the mechanism.
+	if s.mech == nil {
+		newMech, ok := s.mechs[strings.ToUpper(param)]
+		if !ok {
+			return []irc.Message{
+				s.reply(irc.ReplySASLMechs, nick, s.Mechanisms(),
+					"are available SASL mechanisms"),
+				s.fail(nick),
+			}, nil
+		}
+		s.mech = newMech(s.store)
+		return []irc.Message{{Command: "AUTHENTICATE", Params: []string{"+"}}},
+			nil
+	}
+
+	if len(param) > ChunkSize {
+		s.reset()
+		return []irc.Message{s.reply(irc.ErrorSASLTooLong, nick,
+			"SASL message too long")}, nil
+	}
+
+	response, complete, err := s.buf.Add(param)
+	if err != nil {
+		s.reset()
+		if errors.Is(err, ErrPayloadTooLong) {
+			return []irc.Message{s.reply(irc.ErrorSASLTooLong, nick,
+				"SASL message too long")}, nil
+		}
+		return []irc.Message{s.fail(nick)}, nil
+	}
+	if !complete {
+		return nil, nil
+	}
+
+	challenge, done, account, err := s.mech.Next(response)
+	if err != nil {
+		s.reset()
+		return []irc.Message{s.fail(nick)}, nil
+	}
+
+	if !done {
+		return Authenticate(challenge), nil
+	}
+
+	s.reset()
+	s.account = account
+	return []irc.Message{
+		s.reply(irc.ReplyLoggedIn, nick, mask, account,
+			"You are now logged in as "+account),
+		s.reply(irc.ReplySASLSuccess, nick, "SASL authentication successful"),
+	}, nil
+}
+
+func (s *Server) reset() {
+	s.mech = nil
+	s.buf = Buffer{}
+}
+
+func (s *Server) fail(nick string) irc.Message {
+	return s.reply(irc.ErrorSASLFail, nick, "SASL authentication failed")
+}
+
+func (s *Server) reply(command string, params ...string) irc.Message {
+	return irc.Message{Prefix: s.serverName, Command: command, Params: params}
+}
+
+// plainServer is the server side of PLAIN.
+type plainServer struct {
+	store AccountStore
+}
+
+// Next checks the identity, username, and password.
+//
+// We do not support acting as a different identity.
+func (p *plainServer) Next(response []byte) ([]byte, bool, string, error) {
+	fields := bytes.Split(response, []byte{0})
+	if len(fields) != 3 {
+		return nil, false, "", fmt.Errorf("malformed PLAIN response")
+	}
+
+	identity := string(fields[0])
+	username := string(fields[1])
+	password := string(fields[2])
+
+	if identity != "" && identity != username {
+		return nil, false, "", fmt.Errorf("identity must match username")
+	}
+
+	keys, err := lookupKeys(p.store, username)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	got := NewScramKeys(sha256.New, password, keys.Salt, keys.Iterations)
+	if subtle.ConstantTimeCompare(got.StoredKey, keys.StoredKey) != 1 {
+		return nil, false, "", fmt.Errorf("incorrect password")
+	}
+
+	return nil, true, username, nil
+}
+
+// scramServer is the server side of SCRAM.
+type scramServer struct {
+	hash  func() hash.Hash
+	store AccountStore
+
+	// nonce generates the server nonce. We replace it in tests.
+	nonce func() (string, error)
+
+	step            int
+	username        string
+	keys            ScramKeys
+	gs2Header       string
+	nonceValue      string
+	clientFirstBare string
+	serverFirst     string
+}
+
+func newScramServer(h func() hash.Hash, store AccountStore) *scramServer {
+	return &scramServer{hash: h, store: store, nonce: randomNonce}
+}
+
+// Next processes the client-first-message, the client-final-message, and
+// finally the client's empty response to the server-final-message.
+func (s *scramServer) Next(response []byte) ([]byte, bool, string, error) {
+	s.step++
+	switch s.step {
+	case 1:
+		challenge, err := s.serverFirstMessage(string(response))
+		return challenge, false, "", err
+	case 2:
+		challenge, err := s.serverFinalMessage(string(response))
+		return challenge, false, "", err
+	case 3:
+		if len(response) != 0 {
+			return nil, false, "", fmt.Errorf("unexpected response")
+		}
+		return nil, true, s.username, nil
+	default:
+		return nil, false, "", fmt.Errorf("unexpected response")
+	}
+}
+
+// serverFirstMessage processes the client-first-message and creates the
+// server-first-message.
+//
+// client-first-message = gs2-header client-first-message-bare
+// gs2-header           = gs2-cbind-flag "," [ authzid ] ","
+func (s *scramServer) serverFirstMessage(clientFirst string) ([]byte, error) {
+	// We don't support channel binding. "y" means the client does but thinks
+	// we don't, which is fine.
+	if !strings.HasPrefix(clientFirst, "n,") &&
+		!strings.HasPrefix(clientFirst, "y,") {
+		return nil, fmt.Errorf("unsupported channel binding")
+	}
+
+	idx := strings.IndexByte(clientFirst[2:], ',')
+	if idx == -1 {
+		return nil, fmt.Errorf("malformed client-first-message")
+	}
+	authzid := clientFirst[2 : 2+idx]
+	s.gs2Header = clientFirst[:2+idx+1]
+	s.clientFirstBare = clientFirst[2+idx+1:]
+
+	attrs, err := parseScramAttributes(s.clientFirstBare)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := attrs['m']; ok {
+		return nil, fmt.Errorf("unsupported mandatory extension")
+	}
+
+	s.username = unescapeSaslname(attrs['n'])
+	clientNonce := attrs['r']
+	if s.username == "" || clientNonce == "" {
+		return nil, fmt.Errorf("missing username or nonce")
+	}
+
+	if authzid != "" && unescapeSaslname(strings.TrimPrefix(authzid, "a=")) !=
+		s.username {
+		return nil, fmt.Errorf("identity must match username")
+	}
+
+	s.keys, err = lookupKeys(s.store, s.username)
+	if err != nil {
+		return nil, err
+	}
+
+	serverNonce, err := s.nonce()
+	if err != nil {
+		return nil, fmt.Errorf("error generating nonce: %s", err)
+	}
+	s.nonceValue = clientNonce + serverNonce
+
+	s.serverFirst = "r=" + s.nonceValue + ",s=" +
+		base64.StdEncoding.EncodeToString(s.keys.Salt) + ",i=" +
+		strconv.Itoa(s.keys.Iterations)
+	return []byte(s.serverFirst), nil
+}
+
+// serverFinalMessage checks the client's proof and creates the
+// server-final-message.
+//
+// client-final-message = client-final-message-without-proof "," proof
+func (s *scramServer) serverFinalMessage(clientFinal string) ([]byte, error) {
+	idx := strings.LastIndex(clientFinal, ",p=")
+	if idx == -1 {
+		return nil, fmt.Errorf("missing proof")
+	}
+	withoutProof := clientFinal[:idx]
+
+	attrs, err := parseScramAttributes(clientFinal)
+	if err != nil {
+		return nil, err
+	}
+
+	if attrs['c'] != base64.StdEncoding.EncodeToString([]byte(s.gs2Header)) {
+		return nil, fmt.Errorf("channel binding does not match")
+	}
+	if attrs['r'] != s.nonceValue {
+		return nil, fmt.Errorf("nonce does not match")
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(attrs['p'])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proof")
+	}
+
+	authMessage := s.clientFirstBare + "," + s.serverFirst + "," + withoutProof
+
+	// ClientKey := ClientProof XOR ClientSignature, and we check that
+	// H(ClientKey) is the StoredKey.
+	clientSignature := hmacSum(s.hash, s.keys.StoredKey, authMessage)
+	if len(proof) != len(clientSignature) {
+		return nil, fmt.Errorf("invalid proof")
+	}
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+
+	storedKey := s.hash()
+	_, _ = storedKey.Write(clientKey)
+	if subtle.ConstantTimeCompare(storedKey.Sum(nil), s.keys.StoredKey) != 1 {
+		return nil, fmt.Errorf("incorrect password")
+	}
+
+	serverSignature := hmacSum(s.hash, s.keys.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)),
+		nil
+}
+
+// lookupKeys gets the keys for an account from the store.
+//
+// If there is no such account we return fake keys rather than an error. This
+// way authentication proceeds as it would for a real account and fails only
+// when we check the password. Otherwise a client could tell which accounts
+// exist.
+func lookupKeys(store AccountStore, account string) (ScramKeys, error) {
+	keys, err := store.ScramKeys(account)
+	if err == nil {
+		return keys, nil
+	}
+	if !errors.Is(err, ErrNoAccount) {
+		return ScramKeys{}, err
+	}
+	return fakeKeys(account)
+}
+
+var (
+	fakeSecretOnce  sync.Once
+	fakeSecretValue []byte
+	fakeSecretErr   error
+)
+
+// fakeKeys derives keys for an account that does not exist. They look like
+// those NewPasswordKeys makes. They are the same each time for an account so
+// the salt does not change between attempts, but no password matches them.
+func fakeKeys(account string) (ScramKeys, error) {
+	fakeSecretOnce.Do(func() {
+		fakeSecretValue = make([]byte, 32)
+		if _, err := rand.Read(fakeSecretValue); err != nil {
+			fakeSecretErr = fmt.Errorf("error generating secret: %s", err)
+		}
+	})
+	if fakeSecretErr != nil {
+		return ScramKeys{}, fakeSecretErr
+	}
+
+	return ScramKeys{
+		Salt:       hmacSum(sha256.New, fakeSecretValue, "salt:"+account)[:16],
+		Iterations: DefaultIterations,
+		StoredKey:  hmacSum(sha256.New, fakeSecretValue, "stored:"+account),
+		ServerKey:  hmacSum(sha256.New, fakeSecretValue, "server:"+account),
+	}, nil
+}
+
+// unescapeSaslname reverses escapeSaslname.
+func unescapeSaslname(s string) string {
+	return strings.NewReplacer("=2C", ",", "=3D", "=").Replace(s)
+}
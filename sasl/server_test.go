@@ -0,0 +1,242 @@
+package sasl
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/horgh/irc"
+)
+
+// converse runs a client against a server until the client finishes. It
+// returns the client's error.
+func converse(t *testing.T, c *Client, s *Server) error {
+	pending := []irc.Message{c.Start()}
+
+	for i := 0; i < 100; i++ {
+		if c.Done() {
+			return nil
+		}
+
+		var replies []irc.Message
+		for _, m := range pending {
+			msgs, err := s.Handle(m, "alice", "alice!a@h")
+			if err != nil {
+				t.Fatalf("server Handle(%s) = %s", m, err)
+			}
+			replies = append(replies, msgs...)
+		}
+
+		pending = nil
+		for _, m := range replies {
+			msgs, err := c.Handle(m)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, msgs...)
+		}
+	}
+
+	t.Fatalf("authentication did not finish")
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.SetPassword("alice", "secret"); err != nil {
+		t.Fatalf("SetPassword() = %s", err)
+	}
+	long := strings.Repeat("x", 1000)
+	if err := store.SetPassword("bob", long); err != nil {
+		t.Fatalf("SetPassword() = %s", err)
+	}
+
+	tests := []struct {
+		mech    Mechanism
+		account string
+		success bool
+	}{
+		{&Plain{Username: "alice", Password: "secret"}, "alice", true},
+		{&Plain{Username: "alice", Password: "wrong"}, "", false},
+		{&Plain{Username: "nobody", Password: "secret"}, "", false},
+		{&Plain{Identity: "bob", Username: "alice", Password: "secret"}, "",
+			false},
+		// The response spans several AUTHENTICATE messages.
+		{&Plain{Username: "bob", Password: long}, "bob", true},
+		{NewScramSHA256("alice", "secret"), "alice", true},
+		{NewScramSHA256("alice", "wrong"), "", false},
+		{NewScramSHA256("nobody", "secret"), "", false},
+		// We don't offer these.
+		{NewScramSHA1("alice", "secret"), "", false},
+		{&External{}, "", false},
+	}
+
+	for _, test := range tests {
+		s := NewServer(store, "irc")
+		c := NewClient(test.mech)
+
+		err := converse(t, c, s)
+		if test.success {
+			if err != nil {
+				t.Errorf("%s: authentication failed: %s", test.mech.Name(), err)
+				continue
+			}
+		} else if err == nil {
+			t.Errorf("%s: authentication succeeded, wanted failure",
+				test.mech.Name())
+			continue
+		}
+
+		if s.Account() != test.account || c.Account() != test.account {
+			t.Errorf("%s: server account %q, client account %q, wanted %q",
+				test.mech.Name(), s.Account(), c.Account(), test.account)
+		}
+	}
+}
+
+func TestServerReplies(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.SetPassword("alice", "secret"); err != nil {
+		t.Fatalf("SetPassword() = %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		last  string
+	}{
+		{"unknown mechanism", []string{"AUTHENTICATE FOO\r\n"},
+			irc.ErrorSASLFail},
+		{"abort", []string{"AUTHENTICATE PLAIN\r\n", "AUTHENTICATE *\r\n"},
+			irc.ErrorSASLAborted},
+		{"chunk too long", []string{"AUTHENTICATE PLAIN\r\n",
+			"AUTHENTICATE " + strings.Repeat("A", 401) + "\r\n"},
+			irc.ErrorSASLTooLong},
+		{"invalid base64", []string{"AUTHENTICATE PLAIN\r\n",
+			"AUTHENTICATE !!!!\r\n"}, irc.ErrorSASLFail},
+		{"already authenticated", []string{"AUTHENTICATE PLAIN\r\n",
+			"AUTHENTICATE AGFsaWNlAHNlY3JldA==\r\n", "AUTHENTICATE PLAIN\r\n"},
+			irc.ErrorSASLAlready},
+	}
+
+	for _, test := range tests {
+		s := NewServer(store, "irc")
+
+		var last []irc.Message
+		for _, line := range test.lines {
+			m, err := irc.ParseMessage(line)
+			if err != nil {
+				t.Fatalf("ParseMessage(%q) = %s", line, err)
+			}
+
+			last, err = s.Handle(m, "alice", "alice!a@h")
+			if err != nil {
+				t.Fatalf("%s: Handle(%s) = %s", test.name, m, err)
+			}
+		}
+
+		if len(last) == 0 || last[len(last)-1].Command != test.last {
+			t.Errorf("%s: last replies %v, wanted %s", test.name, last, test.last)
+		}
+	}
+}
+
+func TestServerTooLong(t *testing.T) {
+	s := NewServer(NewMemoryStore(), "irc")
+
+	if _, err := s.Handle(irc.Message{Command: "AUTHENTICATE",
+		Params: []string{"PLAIN"}}, "alice", "alice!a@h"); err != nil {
+		t.Fatalf("Handle() = %s", err)
+	}
+
+	chunk := strings.Repeat("A", ChunkSize)
+	for i := 0; ; i++ {
+		msgs, err := s.Handle(irc.Message{Command: "AUTHENTICATE",
+			Params: []string{chunk}}, "alice", "alice!a@h")
+		if err != nil {
+			t.Fatalf("Handle() = %s", err)
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+
+		if msgs[0].Command != irc.ErrorSASLTooLong {
+			t.Errorf("got %s, wanted ERR_SASLTOOLONG", msgs[0])
+		}
+		if (i+1)*ChunkSize <= MaxPayloadLength {
+			t.Errorf("rejected after %d bytes", (i+1)*ChunkSize)
+		}
+		return
+	}
+}
+
+func TestServerUnknownAccount(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.SetPassword("alice", "secret"); err != nil {
+		t.Fatalf("SetPassword() = %s", err)
+	}
+
+	// An unknown account gets a challenge like a real one. Its salt is the
+	// same each time.
+	var salts []string
+	for _, account := range []string{"nobody", "nobody", "alice"} {
+		s := newScramServer(sha256.New, store)
+		challenge, done, _, err := s.Next([]byte("n,,n=" + account + ",r=abc"))
+		if err != nil || done {
+			t.Fatalf("Next() for %s = %v, %v, wanted a challenge", account, done,
+				err)
+		}
+
+		attrs, err := parseScramAttributes(string(challenge))
+		if err != nil {
+			t.Fatalf("parseScramAttributes(%q) = %s", challenge, err)
+		}
+		salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+		if err != nil || len(salt) != 16 {
+			t.Errorf("%s: salt %q, wanted 16 bytes", account, attrs['s'])
+		}
+		if attrs['i'] != "4096" {
+			t.Errorf("%s: iterations %s, wanted 4096", account, attrs['i'])
+		}
+		salts = append(salts, attrs['s'])
+	}
+
+	if salts[0] != salts[1] {
+		t.Errorf("salts for an unknown account differ: %s, %s", salts[0],
+			salts[1])
+	}
+
+	// PLAIN fails the same way for an unknown account as for a wrong
+	// password.
+	p := &plainServer{store: store}
+	_, _, _, unknownErr := p.Next([]byte("\x00nobody\x00secret"))
+	_, _, _, wrongErr := p.Next([]byte("\x00alice\x00wrong"))
+	if unknownErr == nil || wrongErr == nil ||
+		unknownErr.Error() != wrongErr.Error() {
+		t.Errorf("unknown account gave %v, wrong password gave %v", unknownErr,
+			wrongErr)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.SetPassword("alice", "secret"); err != nil {
+		t.Fatalf("SetPassword() = %s", err)
+	}
+
+	keys, err := store.ScramKeys("alice")
+	if err != nil {
+		t.Fatalf("ScramKeys() = %s", err)
+	}
+	if len(keys.Salt) == 0 || keys.Iterations != DefaultIterations ||
+		len(keys.StoredKey) == 0 || len(keys.ServerKey) == 0 {
+		t.Errorf("ScramKeys() = %+v", keys)
+	}
+
+	store.Remove("alice")
+	if _, err := store.ScramKeys("alice"); !errors.Is(err, ErrNoAccount) {
+		t.Errorf("ScramKeys() after Remove = %v, wanted ErrNoAccount", err)
+	}
+}
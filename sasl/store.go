@@ -0,0 +1,83 @@
+package sasl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoAccount is the error an AccountStore returns when there is no such
+// account.
+var ErrNoAccount = errors.New("no such account")
+
+// AccountStore looks up account credentials.
+//
+// We store SCRAM-SHA-256 keys rather than passwords. We can check a PLAIN
+// password against them as well.
+type AccountStore interface {
+	// ScramKeys returns the SCRAM-SHA-256 keys for the account. If there is no
+	// such account it returns ErrNoAccount.
+	ScramKeys(account string) (ScramKeys, error)
+}
+
+// DefaultIterations is the SCRAM iteration count we use when deriving keys.
+// RFC 7677 recommends at least 4096.
+const DefaultIterations = 4096
+
+// NewPasswordKeys derives SCRAM-SHA-256 keys for a password using a random
+// salt. Use it to create what an AccountStore stores.
+func NewPasswordKeys(password string) (ScramKeys, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return ScramKeys{}, fmt.Errorf("error generating salt: %s", err)
+	}
+	return NewScramKeys(sha256.New, password, salt, DefaultIterations), nil
+}
+
+// MemoryStore is an AccountStore that holds accounts in memory. It is useful
+// for tests.
+//
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	accounts map[string]ScramKeys
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{accounts: map[string]ScramKeys{}}
+}
+
+// SetPassword creates the account or changes its password.
+func (s *MemoryStore) SetPassword(account, password string) error {
+	keys, err := NewPasswordKeys(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[account] = keys
+	return nil
+}
+
+// Remove removes the account.
+func (s *MemoryStore) Remove(account string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, account)
+}
+
+// ScramKeys returns the SCRAM-SHA-256 keys for the account.
+func (s *MemoryStore) ScramKeys(account string) (ScramKeys, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys, ok := s.accounts[account]
+	if !ok {
+		return ScramKeys{}, ErrNoAccount
+	}
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Standard reply types. See
+// https://ircv3.net/specs/extensions/standard-replies.
+const (
+	ReplyTypeFail = "FAIL"
+	ReplyTypeWarn = "WARN"
+	ReplyTypeNote = "NOTE"
+)
+
+// StandardReply is a FAIL, WARN, or NOTE message.
+//
+// It is an error. errors.Is matches it against another StandardReply by
+// type, command, and code, ignoring those that are blank in the target. This
+// means you can declare sentinels such as:
+//
+//	var ErrAccountRequired = &StandardReply{Type: ReplyTypeFail,
+//		Code: "ACCOUNT_REQUIRED"}
+type StandardReply struct {
+	// Type is FAIL, WARN, or NOTE.
+	Type string
+
+	// Command is the command the reply is about. It is * if it is not about a
+	// particular command.
+	Command string
+
+	// Code is a machine readable code such as INVALID_TARGET.
+	Code string
+
+	// Context holds the parameters between the code and the description.
+	Context []string
+
+	// Description is for humans.
+	Description string
+}
+
+// NewFail creates a FAIL reply.
+func NewFail(command, code, description string,
+	context ...string) *StandardReply {
+	return newStandardReply(ReplyTypeFail, command, code, description, context)
+}
+
+// NewWarn creates a WARN reply.
+func NewWarn(command, code, description string,
+	context ...string) *StandardReply {
+	return newStandardReply(ReplyTypeWarn, command, code, description, context)
+}
+
+// NewNote creates a NOTE reply.
+func NewNote(command, code, description string,
+	context ...string) *StandardReply {
+	return newStandardReply(ReplyTypeNote, command, code, description, context)
+}
+
+func newStandardReply(replyType, command, code, description string,
+	context []string) *StandardReply {
+	if command == "" {
+		command = "*"
+	}
+	return &StandardReply{
+		Type:        replyType,
+		Command:     command,
+		Code:        code,
+		Context:     context,
+		Description: description,
+	}
+}
+
+// IsStandardReply returns true if the message is a FAIL, WARN, or NOTE.
+func IsStandardReply(m Message) bool {
+	return m.Command == ReplyTypeFail || m.Command == ReplyTypeWarn ||
+		m.Command == ReplyTypeNote
+}
+
+// ParseStandardReply parses a FAIL, WARN, or NOTE message.
+//
+// <type> <command> <code> [<context>...] :<description>
+func ParseStandardReply(m Message) (*StandardReply, error) {
+	if !IsStandardReply(m) {
+		return nil, fmt.Errorf("not a standard reply: %s", m.Command)
+	}
+	if len(m.Params) < 3 {
+		return nil, fmt.Errorf("malformed %s: %s", m.Command, m)
+	}
+
+	var context []string
+	if len(m.Params) > 3 {
+		context = m.Params[2 : len(m.Params)-1]
+	}
+
+	return &StandardReply{
+		Type:        m.Command,
+		Command:     m.Params[0],
+		Code:        m.Params[1],
+		Context:     context,
+		Description: m.Params[len(m.Params)-1],
+	}, nil
+}
+
+// FailError returns the FAIL as an error if the message is a FAIL. Otherwise
+// it returns nil.
+//
+// A malformed FAIL is still an error. We describe it as best we can.
+func FailError(m Message) error {
+	if m.Command != ReplyTypeFail {
+		return nil
+	}
+
+	r, err := ParseStandardReply(m)
+	if err != nil {
+		return NewFail("*", "", strings.Join(m.Params, " "))
+	}
+	return r
+}
+
+// Message creates the message for the reply. prefix is the server's name.
+func (r *StandardReply) Message(prefix string) Message {
+	params := []string{r.Command, r.Code}
+	params = append(params, r.Context...)
+	params = append(params, r.Description)
+
+	return Message{Prefix: prefix, Command: r.Type, Params: params}
+}
+
+// Error describes the reply.
+func (r *StandardReply) Error() string {
+	s := r.Type + " " + r.Command + " " + r.Code
+	if len(r.Context) > 0 {
+		s += " " + strings.Join(r.Context, " ")
+	}
+	return s + ": " + r.Description
+}
+
+// Is reports whether the reply matches target. See StandardReply.
+func (r *StandardReply) Is(target error) bool {
+	t, ok := target.(*StandardReply)
+	if !ok {
+		return false
+	}
+
+	return (t.Type == "" || t.Type == r.Type) &&
+		(t.Command == "" || t.Command == r.Command) &&
+		(t.Code == "" || t.Code == r.Code)
+}
@@ -0,0 +1,114 @@
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStandardReply(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *StandardReply
+		success bool
+	}{
+		{
+			"FAIL * ACCOUNT_REQUIRED :Authentication required\r\n",
+			&StandardReply{Type: ReplyTypeFail, Command: "*",
+				Code: "ACCOUNT_REQUIRED", Description: "Authentication required"},
+			true,
+		},
+		{
+			":irc WARN REHASH CERTS_EXPIRED cert.pem :Certificate has expired\r\n",
+			&StandardReply{Type: ReplyTypeWarn, Command: "REHASH",
+				Code: "CERTS_EXPIRED", Context: []string{"cert.pem"},
+				Description: "Certificate has expired"},
+			true,
+		},
+		{
+			"NOTE * OPER_MESSAGE :hello\r\n",
+			&StandardReply{Type: ReplyTypeNote, Command: "*", Code: "OPER_MESSAGE",
+				Description: "hello"},
+			true,
+		},
+		{"FAIL JOIN :no\r\n", nil, false},
+		{"PRIVMSG #test :hi\r\n", nil, false},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		got, err := ParseStandardReply(m)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseStandardReply(%q) = %s", test.input, err)
+			}
+			continue
+		}
+		if !test.success {
+			t.Errorf("ParseStandardReply(%q) succeeded, wanted error", test.input)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseStandardReply(%q) = %+v, wanted %+v", test.input, got,
+				test.want)
+		}
+
+		// Going back to a message gives us what we started with.
+		if back := got.Message(m.Prefix); !reflect.DeepEqual(back, m) {
+			t.Errorf("Message() = %s, wanted %s", back, m)
+		}
+	}
+}
+
+func TestStandardReplyErrors(t *testing.T) {
+	errAccountRequired := &StandardReply{Type: ReplyTypeFail,
+		Code: "ACCOUNT_REQUIRED"}
+
+	err := FailError(NewFail("JOIN", "ACCOUNT_REQUIRED",
+		"You must be logged in", "#test").Message("irc"))
+
+	if !errors.Is(err, errAccountRequired) {
+		t.Errorf("errors.Is(%s, ACCOUNT_REQUIRED) = false", err)
+	}
+	if !errors.Is(err, &StandardReply{Command: "JOIN"}) {
+		t.Errorf("errors.Is(%s, JOIN) = false", err)
+	}
+	if errors.Is(err, &StandardReply{Code: "OTHER"}) {
+		t.Errorf("errors.Is(%s, OTHER) = true", err)
+	}
+
+	var reply *StandardReply
+	if !errors.As(err, &reply) || reply.Context[0] != "#test" {
+		t.Errorf("errors.As(%s) gave %+v", err, reply)
+	}
+
+	if err.Error() !=
+		"FAIL JOIN ACCOUNT_REQUIRED #test: You must be logged in" {
+		t.Errorf("Error() = %s", err)
+	}
+
+	if err := FailError(NewWarn("JOIN", "X", "warning").Message("irc")); err != nil {
+		t.Errorf("FailError() for WARN = %s, wanted nil", err)
+	}
+}
+
+func TestLabelTrackerFail(t *testing.T) {
+	tracker := NewLabelTracker(time.Minute)
+	m, ch := tracker.Send(Message{Command: "JOIN", Params: []string{"#test"}})
+
+	reply := NewFail("JOIN", "ACCOUNT_REQUIRED", "You must be logged in",
+		"#test").Message("irc").WithLabel(m.Label())
+	if !tracker.Add(reply) {
+		t.Fatalf("Add(%s) did not match", reply)
+	}
+
+	resp := <-ch
+	if !errors.Is(resp.Err, &StandardReply{Code: "ACCOUNT_REQUIRED"}) {
+		t.Errorf("response error = %v, wanted ACCOUNT_REQUIRED", resp.Err)
+	}
+}
@@ -0,0 +1,163 @@
+package irc
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// Tags with defined meanings.
+const (
+	// TagTime is the server-time tag. Its value is when the server saw the
+	// message, in ServerTimeFormat.
+	TagTime = "time"
+
+	// TagMsgID is the message ID tag.
+	TagMsgID = "msgid"
+
+	// TagAccount is the account-tag tag. It holds the sender's account.
+	TagAccount = "account"
+
+	// TagBatch is the batch tag. It holds the reference tag of the batch the
+	// message is part of.
+	TagBatch = "batch"
+
+	// TagLabel is the labeled-response tag.
+	TagLabel = "label"
+
+	// TagReply is the client tag holding the msgid of the message this one
+	// replies to.
+	TagReply = "+draft/reply"
+)
+
+// ServerTimeFormat is the format of server-time tag values. It is UTC with
+// millisecond precision.
+const ServerTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// FormatServerTime formats a time as a server-time tag value.
+func FormatServerTime(t time.Time) string {
+	return t.UTC().Format(ServerTimeFormat)
+}
+
+// ParseServerTime parses a server-time tag value.
+//
+// We accept any RFC 3339 time since not all servers use exactly three
+// fractional digits.
+func ParseServerTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// NewMsgID creates a random message ID suitable for the msgid tag.
+func NewMsgID() string {
+	buf := make([]byte, 15)
+	// crypto/rand's Read does not fail in practice.
+	_, _ = rand.Read(buf)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+}
+
+// Tag returns the value of a tag and whether the message has it.
+func (m Message) Tag(key string) (string, bool) {
+	value, ok := m.Tags[key]
+	return value, ok
+}
+
+// ServerTime returns the time from the server-time tag. If the message does
+// not have the tag or it is invalid, we return false.
+func (m Message) ServerTime() (time.Time, bool) {
+	value, ok := m.Tags[TagTime]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := ParseServerTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// MsgID returns the msgid tag. It is blank if there is none.
+func (m Message) MsgID() string {
+	return m.Tags[TagMsgID]
+}
+
+// Account returns the account tag. It is blank if there is none.
+func (m Message) Account() string {
+	return m.Tags[TagAccount]
+}
+
+// Batch returns the batch tag. It is blank if there is none.
+func (m Message) Batch() string {
+	return m.Tags[TagBatch]
+}
+
+// Label returns the label tag. It is blank if there is none.
+func (m Message) Label() string {
+	return m.Tags[TagLabel]
+}
+
+// ReplyTo returns the msgid from the +draft/reply tag. It is blank if there
+// is none.
+func (m Message) ReplyTo() string {
+	return m.Tags[TagReply]
+}
+
+// WithTag returns a copy of the message with the tag set.
+//
+// The copy has its own tags so changing them does not affect the original.
+func (m Message) WithTag(key, value string) Message {
+	tags := make(map[string]string, len(m.Tags)+1)
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	tags[key] = value
+	m.Tags = tags
+	return m
+}
+
+// WithoutTag returns a copy of the message without the tag.
+func (m Message) WithoutTag(key string) Message {
+	if _, ok := m.Tags[key]; !ok {
+		return m
+	}
+
+	tags := make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		if k != key {
+			tags[k] = v
+		}
+	}
+	m.Tags = tags
+	return m
+}
+
+// WithServerTime returns a copy of the message with the server-time tag set.
+func (m Message) WithServerTime(t time.Time) Message {
+	return m.WithTag(TagTime, FormatServerTime(t))
+}
+
+// WithMsgID returns a copy of the message with the msgid tag set.
+func (m Message) WithMsgID(id string) Message {
+	return m.WithTag(TagMsgID, id)
+}
+
+// WithAccount returns a copy of the message with the account tag set.
+func (m Message) WithAccount(account string) Message {
+	return m.WithTag(TagAccount, account)
+}
+
+// WithBatch returns a copy of the message with the batch tag set.
+func (m Message) WithBatch(ref string) Message {
+	return m.WithTag(TagBatch, ref)
+}
+
+// WithLabel returns a copy of the message with the label tag set.
+func (m Message) WithLabel(label string) Message {
+	return m.WithTag(TagLabel, label)
+}
+
+// WithReplyTo returns a copy of the message with the +draft/reply tag set.
+func (m Message) WithReplyTo(msgID string) Message {
+	return m.WithTag(TagReply, msgID)
+}
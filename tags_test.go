@@ -0,0 +1,107 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerTime(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+		want  time.Time
+	}{
+		{"@time=2019-02-03T04:05:06.789Z PING\r\n", true,
+			time.Date(2019, 2, 3, 4, 5, 6, 789000000, time.UTC)},
+		// Not exactly three fractional digits.
+		{"@time=2019-02-03T04:05:06Z PING\r\n", true,
+			time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)},
+		{"@time=yesterday PING\r\n", false, time.Time{}},
+		{"PING\r\n", false, time.Time{}},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		got, ok := m.ServerTime()
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("ServerTime() for %q = %s, %v, wanted %s, %v", test.input, got,
+				ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestFormatServerTime(t *testing.T) {
+	tests := []struct {
+		input time.Time
+		want  string
+	}{
+		{time.Date(2019, 2, 3, 4, 5, 6, 789123456, time.UTC),
+			"2019-02-03T04:05:06.789Z"},
+		{time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC), "2019-02-03T04:05:06.000Z"},
+		// We convert to UTC.
+		{time.Date(2019, 2, 3, 4, 5, 6, 0, time.FixedZone("EST", -5*60*60)),
+			"2019-02-03T09:05:06.000Z"},
+	}
+
+	for _, test := range tests {
+		if got := FormatServerTime(test.input); got != test.want {
+			t.Errorf("FormatServerTime(%s) = %s, wanted %s", test.input, got,
+				test.want)
+		}
+	}
+}
+
+func TestTagHelpers(t *testing.T) {
+	orig := Message{Command: "PRIVMSG", Params: []string{"#test", "hi"}}
+
+	m := orig.
+		WithServerTime(time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)).
+		WithMsgID("id1").
+		WithAccount("alice").
+		WithBatch("b1").
+		WithLabel("l1").
+		WithReplyTo("id0")
+
+	if orig.Tags != nil {
+		t.Errorf("original message changed: %s", orig)
+	}
+
+	buf, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode() = %s", err)
+	}
+
+	want := "@+draft/reply=id0;account=alice;batch=b1;label=l1;msgid=id1;" +
+		"time=2019-02-03T04:05:06.000Z PRIVMSG #test hi\r\n"
+	if buf != want {
+		t.Errorf("Encode() = %q, wanted %q", buf, want)
+	}
+
+	if m.MsgID() != "id1" || m.Account() != "alice" || m.Batch() != "b1" ||
+		m.Label() != "l1" || m.ReplyTo() != "id0" {
+		t.Errorf("tag accessors gave %q %q %q %q %q", m.MsgID(), m.Account(),
+			m.Batch(), m.Label(), m.ReplyTo())
+	}
+
+	without := m.WithoutTag(TagLabel)
+	if _, ok := without.Tag(TagLabel); ok {
+		t.Errorf("WithoutTag() left the tag")
+	}
+	if _, ok := m.Tag(TagLabel); !ok {
+		t.Errorf("WithoutTag() changed the original")
+	}
+}
+
+func TestNewMsgID(t *testing.T) {
+	a, b := NewMsgID(), NewMsgID()
+	if a == b || a == "" {
+		t.Errorf("NewMsgID() gave %q and %q", a, b)
+	}
+	if len(a) != 24 {
+		t.Errorf("NewMsgID() = %q, wanted 24 characters", a)
+	}
+}
@@ -35,11 +35,6 @@ func TestIRCParserTestsMsgSplit(t *testing.T) {
 	}
 
 	for _, test := range tests.Tests {
-		if test.Atoms.Tags != nil {
-			// We don't support tags right now.
-			continue
-		}
-
 		if test.Input ==
 			":gravel.mozilla.org 432  #momo :Erroneous Nickname: Illegal characters" {
 			// This is an invalid message. I'm not inclined to support it.
@@ -81,9 +76,40 @@ func TestIRCParserTestsMsgSplit(t *testing.T) {
 			t.Errorf("%s: prefix is %s, wanted %s", test.Input, msg.Prefix, prefix)
 			continue
 		}
+
+		wantTags := vendorTags(test.Atoms.Tags)
+		if len(msg.Tags) != len(wantTags) {
+			t.Errorf("%s: got %d tags, wanted %d", test.Input, len(msg.Tags),
+				len(wantTags))
+			continue
+		}
+
+		for k, v := range wantTags {
+			if got, ok := msg.Tags[k]; !ok || got != v {
+				t.Errorf("%s: tag %s is %q, wanted %q", test.Input, k, got, v)
+			}
+		}
 	}
 }
 
+// vendorTags converts tags from the test files. A tag without a value is null
+// in the files. We treat that the same as an empty value.
+func vendorTags(tags map[string]interface{}) map[string]string {
+	if tags == nil {
+		return nil
+	}
+
+	m := map[string]string{}
+	for k, v := range tags {
+		if s, ok := v.(string); ok {
+			m[k] = s
+			continue
+		}
+		m[k] = ""
+	}
+	return m
+}
+
 // msg-join tests from irc-parser-tests
 func TestIRCParserTestsMsgJoin(t *testing.T) {
 	testFile := filepath.Join("irc-parser-tests", "tests", "msg-join.yaml")
@@ -111,12 +137,8 @@ func TestIRCParserTestsMsgJoin(t *testing.T) {
 	}
 
 	for _, test := range tests.Tests {
-		if test.Atoms.Tags != nil {
-			// We don't support tags currently.
-			continue
-		}
-
 		msg := Message{
+			Tags:    vendorTags(test.Atoms.Tags),
 			Prefix:  test.Atoms.Source,
 			Command: test.Atoms.Verb,
 			Params:  test.Atoms.Params,
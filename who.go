@@ -0,0 +1,352 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WHOX fields. These are the letters that select fields in a WHOX query such
+// as "WHO #channel %tcuhnfar,42". Replies contain the requested fields in the
+// order given here, regardless of the order in the query.
+const (
+	WhoxToken    = 't'
+	WhoxChannel  = 'c'
+	WhoxUser     = 'u'
+	WhoxIP       = 'i'
+	WhoxHost     = 'h'
+	WhoxServer   = 's'
+	WhoxNick     = 'n'
+	WhoxFlags    = 'f'
+	WhoxHopCount = 'd'
+	WhoxIdle     = 'l'
+	WhoxAccount  = 'a'
+	WhoxOpLevel  = 'o'
+	WhoxRealName = 'r'
+)
+
+// whoxOrder is the order fields appear in an RPL_WHOSPCRPL.
+const whoxOrder = "tcuihsnfdlaor"
+
+// WhoQuery describes a WHO request.
+type WhoQuery struct {
+	// Mask is the channel or mask to query.
+	Mask string
+
+	// Fields holds the WHOX fields to request, such as "cuhnfar". If it is
+	// empty we send a plain WHO.
+	//
+	// The token field is added automatically if Token is set.
+	Fields string
+
+	// Token is a number up to 3 digits that the server echoes back in each
+	// reply. It lets us tell replies to different queries apart. It is only
+	// sent in WHOX queries. Zero means not to send one.
+	Token int
+}
+
+// Message creates the WHO message for the query.
+func (q WhoQuery) Message() (Message, error) {
+	if q.Mask == "" {
+		return Message{}, fmt.Errorf("mask must not be blank")
+	}
+
+	if q.Fields == "" {
+		return Message{Command: "WHO", Params: []string{q.Mask}}, nil
+	}
+
+	fields := q.fields()
+	for i := 0; i < len(fields); i++ {
+		if strings.IndexByte(whoxOrder, fields[i]) == -1 {
+			return Message{}, fmt.Errorf("unknown WHOX field: %c", fields[i])
+		}
+	}
+
+	if q.Token < 0 || q.Token > 999 {
+		return Message{}, fmt.Errorf("token must be between 0 and 999")
+	}
+
+	arg := "%" + fields
+	if q.Token != 0 {
+		arg += "," + strconv.Itoa(q.Token)
+	}
+
+	return Message{Command: "WHO", Params: []string{q.Mask, arg}}, nil
+}
+
+// fields returns the fields to request, including the token field if
+// needed.
+func (q WhoQuery) fields() string {
+	if q.Token != 0 && strings.IndexByte(q.Fields, WhoxToken) == -1 {
+		return string(WhoxToken) + q.Fields
+	}
+	return q.Fields
+}
+
+// WhoReply holds a single WHO reply, either an RPL_WHOREPLY or an
+// RPL_WHOSPCRPL (WHOX).
+//
+// For WHOX replies, only requested fields are set.
+type WhoReply struct {
+	// Token is the query token. WHOX only.
+	Token int
+
+	// Channel is the channel the reply is about, or "*" if none.
+	Channel string
+
+	User   string
+	Host   string
+	Server string
+	Nick   string
+
+	// IP is the user's IP address. WHOX only.
+	IP string
+
+	// Away is true if the user is away.
+	Away bool
+
+	// Oper is true if the user is an IRC operator.
+	Oper bool
+
+	// Symbols holds the user's channel prefix symbols, such as "@+".
+	Symbols string
+
+	// Modes holds the modes corresponding to Symbols, such as "ov".
+	Modes string
+
+	// HopCount is the number of server hops to the user.
+	HopCount int
+
+	// Idle is the user's idle time in seconds. WHOX only.
+	Idle int
+
+	// Account is the user's account name, or blank if they are not logged in.
+	// WHOX only.
+	Account string
+
+	// OpLevel is the user's op level. WHOX only.
+	OpLevel string
+
+	RealName string
+}
+
+// ParseWhoReply parses an RPL_WHOREPLY.
+//
+// <client> <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
+func ParseWhoReply(m Message, prefixes Prefixes) (WhoReply, error) {
+	if m.Command != ReplyWhoReply {
+		return WhoReply{}, fmt.Errorf("not an RPL_WHOREPLY: %s", m.Command)
+	}
+
+	if len(m.Params) != 8 {
+		return WhoReply{}, fmt.Errorf("malformed RPL_WHOREPLY: %s", m)
+	}
+
+	r := WhoReply{
+		Channel: m.Params[1],
+		User:    m.Params[2],
+		Host:    m.Params[3],
+		Server:  m.Params[4],
+		Nick:    m.Params[5],
+	}
+	r.parseFlags(m.Params[6], prefixes)
+
+	hops := m.Params[7]
+	realName := ""
+	if idx := strings.IndexByte(hops, ' '); idx != -1 {
+		realName = hops[idx+1:]
+		hops = hops[:idx]
+	}
+
+	hopCount, err := strconv.Atoi(hops)
+	if err != nil {
+		return WhoReply{}, fmt.Errorf("invalid hop count: %s", m)
+	}
+	r.HopCount = hopCount
+	r.RealName = realName
+
+	return r, nil
+}
+
+// ParseWhoxReply parses an RPL_WHOSPCRPL. fields must be the fields requested
+// in the query, since the reply does not say which fields it contains.
+//
+// <client> [token] [channel] [user] [ip] [host] [server] [nick] [flags]
+// [hopcount] [idle] [account] [oplevel] [:realname]
+func ParseWhoxReply(m Message, fields string,
+	prefixes Prefixes) (WhoReply, error) {
+	if m.Command != ReplyWhoSpcRpl {
+		return WhoReply{}, fmt.Errorf("not an RPL_WHOSPCRPL: %s", m.Command)
+	}
+
+	var present []byte
+	for i := 0; i < len(whoxOrder); i++ {
+		if strings.IndexByte(fields, whoxOrder[i]) != -1 {
+			present = append(present, whoxOrder[i])
+		}
+	}
+
+	if len(m.Params) != len(present)+1 {
+		return WhoReply{}, fmt.Errorf(
+			"RPL_WHOSPCRPL has %d fields, expected %d: %s", len(m.Params)-1,
+			len(present), m)
+	}
+
+	r := WhoReply{}
+	for i, field := range present {
+		value := m.Params[i+1]
+
+		switch field {
+		case WhoxToken:
+			token, err := strconv.Atoi(value)
+			if err != nil {
+				return WhoReply{}, fmt.Errorf("invalid token: %s", m)
+			}
+			r.Token = token
+		case WhoxChannel:
+			r.Channel = value
+		case WhoxUser:
+			r.User = value
+		case WhoxIP:
+			r.IP = value
+		case WhoxHost:
+			r.Host = value
+		case WhoxServer:
+			r.Server = value
+		case WhoxNick:
+			r.Nick = value
+		case WhoxFlags:
+			r.parseFlags(value, prefixes)
+		case WhoxHopCount:
+			hopCount, err := strconv.Atoi(value)
+			if err != nil {
+				return WhoReply{}, fmt.Errorf("invalid hop count: %s", m)
+			}
+			r.HopCount = hopCount
+		case WhoxIdle:
+			idle, err := strconv.Atoi(value)
+			if err != nil {
+				return WhoReply{}, fmt.Errorf("invalid idle time: %s", m)
+			}
+			r.Idle = idle
+		case WhoxAccount:
+			// 0 means not logged in.
+			if value != "0" {
+				r.Account = value
+			}
+		case WhoxOpLevel:
+			r.OpLevel = value
+		case WhoxRealName:
+			r.RealName = value
+		}
+	}
+
+	return r, nil
+}
+
+// parseFlags parses the flags field. It starts with H (here) or G (gone),
+// then optionally * (oper), then channel prefix symbols. Some servers include
+// other flags such as B (bot) or r (registered). We skip those.
+func (r *WhoReply) parseFlags(flags string, prefixes Prefixes) {
+	for i := 0; i < len(flags); i++ {
+		c := flags[i]
+
+		if mode := prefixes.ModeFor(c); mode != 0 {
+			r.Symbols += string(c)
+			r.Modes += string(mode)
+			continue
+		}
+
+		switch c {
+		case 'G':
+			r.Away = true
+		case '*':
+			r.Oper = true
+		}
+	}
+}
+
+// WhoCollector gathers WHO replies until the RPL_ENDOFWHO for the query.
+//
+// Collect one query at a time. If you have several outstanding WHOX queries,
+// use a different token for each and a collector per query.
+type WhoCollector struct {
+	query    WhoQuery
+	prefixes Prefixes
+	replies  []WhoReply
+}
+
+// NewWhoCollector creates a collector for replies to the given query.
+func NewWhoCollector(query WhoQuery, prefixes Prefixes) *WhoCollector {
+	return &WhoCollector{query: query, prefixes: prefixes}
+}
+
+// Add processes a message.
+//
+// When the message is the RPL_ENDOFWHO for the query we return all of the
+// replies and true. Other messages give false. Messages that are not part of
+// the query's replies are ignored. This includes WHOX replies with a
+// different token and, if we queried a channel, WHO replies about another
+// channel.
+//
+// We accept WHO replies even for a WHOX query since a server without WHOX
+// answers with them. Those replies have every field but the token.
+//
+// We return an error if a reply is malformed.
+func (c *WhoCollector) Add(m Message) ([]WhoReply, bool, error) {
+	switch m.Command {
+	case ReplyWhoReply:
+		r, err := ParseWhoReply(m, c.prefixes)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if IsChannel(c.query.Mask) &&
+			foldName(r.Channel) != foldName(c.query.Mask) {
+			return nil, false, nil
+		}
+		c.replies = append(c.replies, r)
+		return nil, false, nil
+	case ReplyWhoSpcRpl:
+		if c.query.Fields == "" {
+			return nil, false, nil
+		}
+
+		fields := c.query.fields()
+
+		// Check the token before anything else. A reply to another query may
+		// have different fields.
+		if strings.IndexByte(fields, WhoxToken) != -1 {
+			if len(m.Params) < 2 {
+				return nil, false, nil
+			}
+			token, err := strconv.Atoi(m.Params[1])
+			if err != nil || token != c.query.Token {
+				return nil, false, nil
+			}
+		}
+
+		r, err := ParseWhoxReply(m, fields, c.prefixes)
+		if err != nil {
+			return nil, false, err
+		}
+
+		c.replies = append(c.replies, r)
+		return nil, false, nil
+	case ReplyEndOfWho:
+		// <client> <mask> :End of WHO list
+		if len(m.Params) < 2 {
+			return nil, false, fmt.Errorf("malformed RPL_ENDOFWHO: %s", m)
+		}
+
+		if foldName(m.Params[1]) != foldName(c.query.Mask) {
+			return nil, false, nil
+		}
+
+		replies := c.replies
+		c.replies = nil
+		return replies, true, nil
+	default:
+		return nil, false, nil
+	}
+}
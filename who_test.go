@@ -0,0 +1,304 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhoQueryMessage(t *testing.T) {
+	tests := []struct {
+		input   WhoQuery
+		output  Message
+		success bool
+	}{
+		{
+			WhoQuery{Mask: "#test"},
+			Message{Command: "WHO", Params: []string{"#test"}},
+			true,
+		},
+		{
+			WhoQuery{Mask: "#test", Fields: "cuhnfar", Token: 42},
+			Message{Command: "WHO", Params: []string{"#test", "%tcuhnfar,42"}},
+			true,
+		},
+		{
+			WhoQuery{Mask: "#test", Fields: "tna"},
+			Message{Command: "WHO", Params: []string{"#test", "%tna"}},
+			true,
+		},
+		{WhoQuery{}, Message{}, false},
+		{WhoQuery{Mask: "#test", Fields: "x"}, Message{}, false},
+		{WhoQuery{Mask: "#test", Fields: "n", Token: 1000}, Message{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := test.input.Message()
+		if err != nil {
+			if test.success {
+				t.Errorf("%+v.Message() = %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("%+v.Message() should have failed", test.input)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.output) {
+			t.Errorf("%+v.Message() = %s, wanted %s", test.input, got, test.output)
+		}
+	}
+}
+
+func TestParseWhoReply(t *testing.T) {
+	tests := []struct {
+		input   string
+		output  WhoReply
+		success bool
+	}{
+		{
+			":irc 352 me #test ~u example.com irc.example.com alice H@ :0 Alice A\r\n",
+			WhoReply{Channel: "#test", User: "~u", Host: "example.com",
+				Server: "irc.example.com", Nick: "alice", Symbols: "@", Modes: "o",
+				RealName: "Alice A"},
+			true,
+		},
+		{
+			":irc 352 me * u h s bob G*@+ :3 Bob\r\n",
+			WhoReply{Channel: "*", User: "u", Host: "h", Server: "s", Nick: "bob",
+				Away: true, Oper: true, Symbols: "@+", Modes: "ov", HopCount: 3,
+				RealName: "Bob"},
+			true,
+		},
+		{
+			":irc 352 me * u h s bob H :2\r\n",
+			WhoReply{Channel: "*", User: "u", Host: "h", Server: "s", Nick: "bob",
+				HopCount: 2},
+			true,
+		},
+		{":irc 352 me * u h s bob H :x Bob\r\n", WhoReply{}, false},
+		{":irc 352 me * u h s bob\r\n", WhoReply{}, false},
+		{":irc 354 me 42 bob\r\n", WhoReply{}, false},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		got, err := ParseWhoReply(m, DefaultPrefixes)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseWhoReply(%q) = %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("ParseWhoReply(%q) should have failed", test.input)
+			continue
+		}
+
+		if got != test.output {
+			t.Errorf("ParseWhoReply(%q) = %+v, wanted %+v", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestParseWhoxReply(t *testing.T) {
+	tests := []struct {
+		input   string
+		fields  string
+		output  WhoReply
+		success bool
+	}{
+		{
+			":irc 354 me 42 #test ~u example.com alice H@ alice_acct :Alice A\r\n",
+			"tcuhnfar",
+			WhoReply{Token: 42, Channel: "#test", User: "~u", Host: "example.com",
+				Nick: "alice", Symbols: "@", Modes: "o", Account: "alice_acct",
+				RealName: "Alice A"},
+			true,
+		},
+
+		// Fields come back in a fixed order regardless of the query's order.
+		{
+			":irc 354 me bob 0 :Bob\r\n",
+			"ran",
+			WhoReply{Nick: "bob", RealName: "Bob"},
+			true,
+		},
+		{
+			":irc 354 me 1.2.3.4 bob G 2 300\r\n",
+			"ifnld",
+			WhoReply{IP: "1.2.3.4", Nick: "bob", Away: true, HopCount: 2,
+				Idle: 300},
+			true,
+		},
+		{":irc 354 me bob\r\n", "na", WhoReply{}, false},
+		{":irc 354 me x bob\r\n", "tn", WhoReply{}, false},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMessage(test.input)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", test.input, err)
+		}
+
+		got, err := ParseWhoxReply(m, test.fields, DefaultPrefixes)
+		if err != nil {
+			if test.success {
+				t.Errorf("ParseWhoxReply(%q) = %s", test.input, err)
+			}
+			continue
+		}
+
+		if !test.success {
+			t.Errorf("ParseWhoxReply(%q) should have failed", test.input)
+			continue
+		}
+
+		if got != test.output {
+			t.Errorf("ParseWhoxReply(%q) = %+v, wanted %+v", test.input, got,
+				test.output)
+		}
+	}
+}
+
+func TestWhoCollector(t *testing.T) {
+	c := NewWhoCollector(WhoQuery{Mask: "#test", Fields: "na", Token: 7},
+		DefaultPrefixes)
+
+	lines := []string{
+		":irc 354 me 7 alice alice\r\n",
+		// A reply to a different query.
+		":irc 354 me 8 carol 0\r\n",
+		":irc 354 me 7 bob 0\r\n",
+		// A reply to a query with different fields.
+		":irc 354 me 2 #b user host dave acct :Real Name\r\n",
+		":irc 315 me #other :End of WHO list\r\n",
+		":irc 315 me #Test :End of WHO list\r\n",
+	}
+
+	var got []WhoReply
+	done := false
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		if done {
+			t.Fatalf("collector finished before %q", line)
+		}
+
+		got, done, err = c.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+	}
+
+	if !done {
+		t.Fatalf("collector did not finish")
+	}
+
+	want := []WhoReply{
+		{Token: 7, Nick: "alice", Account: "alice"},
+		{Token: 7, Nick: "bob"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %+v, wanted %+v", got, want)
+	}
+}
+
+func TestWhoCollectorInterleaved(t *testing.T) {
+	channels := NewWhoCollector(WhoQuery{Mask: "#a", Fields: "cn", Token: 1},
+		DefaultPrefixes)
+	users := NewWhoCollector(WhoQuery{Mask: "#a", Fields: "cuhnar", Token: 2},
+		DefaultPrefixes)
+
+	lines := []string{
+		":irc 354 me 1 #a alice\r\n",
+		":irc 354 me 2 #a user host bob acct :Real Name\r\n",
+	}
+
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		for _, c := range []*WhoCollector{channels, users} {
+			if _, _, err := c.Add(m); err != nil {
+				t.Errorf("Add(%s) = %s", m, err)
+			}
+		}
+	}
+
+	end := Message{Command: "315", Params: []string{"me", "#a",
+		"End of WHO list"}}
+
+	tests := []struct {
+		collector *WhoCollector
+		want      []WhoReply
+	}{
+		{channels, []WhoReply{{Token: 1, Channel: "#a", Nick: "alice"}}},
+		{users, []WhoReply{{Token: 2, Channel: "#a", User: "user", Host: "host",
+			Nick: "bob", Account: "acct", RealName: "Real Name"}}},
+	}
+
+	for _, test := range tests {
+		got, done, err := test.collector.Add(end)
+		if err != nil || !done {
+			t.Fatalf("Add(%s) = %v, %v, wanted done", end, done, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("collected %+v, wanted %+v", got, test.want)
+		}
+	}
+}
+
+func TestWhoCollectorWithoutWhox(t *testing.T) {
+	// A server without WHOX answers a WHOX query with plain WHO replies.
+	c := NewWhoCollector(WhoQuery{Mask: "#chan", Fields: "cuhnfar", Token: 42},
+		DefaultPrefixes)
+
+	lines := []string{
+		":irc 352 me #chan alice host1 irc alice H@ :0 Alice A\r\n",
+		// A reply about another channel.
+		":irc 352 me #other carol host3 irc carol H :0 Carol\r\n",
+		":irc 352 me #Chan bob host2 irc bob G :1 Bob\r\n",
+		":irc 315 me #chan :End of WHO list\r\n",
+	}
+
+	var got []WhoReply
+	done := false
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		got, done, err = c.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+	}
+
+	if !done {
+		t.Fatalf("collector did not finish")
+	}
+
+	want := []WhoReply{
+		{Channel: "#chan", User: "alice", Host: "host1", Server: "irc",
+			Nick: "alice", Symbols: "@", Modes: "o", RealName: "Alice A"},
+		{Channel: "#Chan", User: "bob", Host: "host2", Server: "irc", Nick: "bob",
+			Away: true, HopCount: 1, RealName: "Bob"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %+v, wanted %+v", got, want)
+	}
+}
@@ -0,0 +1,251 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// channelTypes holds the characters channel names commonly start with.
+const channelTypes = "#&!+"
+
+// WhoisChannel is a channel listed in a WHOIS reply.
+type WhoisChannel struct {
+	Name string
+
+	// Symbols holds the user's prefix symbols in the channel, such as "@".
+	Symbols string
+
+	// Modes holds the modes corresponding to Symbols, such as "o".
+	Modes string
+}
+
+// WhoisInfo holds the information from a WHOIS reply.
+//
+// Fields are blank if the server did not send them.
+type WhoisInfo struct {
+	Nick     string
+	User     string
+	Host     string
+	RealName string
+
+	// Server is the server the user is on and ServerInfo is its description.
+	Server     string
+	ServerInfo string
+
+	Operator bool
+
+	// Idle is how long the user has been idle and SignOn is when they
+	// connected.
+	Idle   time.Duration
+	SignOn time.Time
+
+	Channels []WhoisChannel
+
+	// Account is the account the user is logged in to.
+	Account string
+
+	// Secure is true if the user is connected using TLS.
+	Secure bool
+
+	// CertFP is the fingerprint of the user's client certificate.
+	CertFP string
+
+	// ActualHost and ActualIP are the user's real host and IP. Usually only
+	// operators can see these.
+	ActualHost string
+	ActualIP   string
+
+	// Away is true if the user is away and AwayMessage is their message.
+	Away        bool
+	AwayMessage string
+
+	// Other holds replies about the user we do not parse, such as
+	// RPL_WHOISHOST or RPL_WHOISSPECIAL.
+	Other []Message
+}
+
+// WhoisCollector gathers the replies to a WHOIS into a WhoisInfo.
+//
+// Messages about other nicks and unrelated messages are ignored, so it is
+// fine to feed it all incoming messages.
+type WhoisCollector struct {
+	nick     string
+	prefixes Prefixes
+	info     *WhoisInfo
+	done     bool
+}
+
+// NewWhoisCollector creates a collector for a WHOIS about the given nick.
+func NewWhoisCollector(nick string, prefixes Prefixes) *WhoisCollector {
+	return &WhoisCollector{
+		nick:     nick,
+		prefixes: prefixes,
+		info:     &WhoisInfo{Nick: nick},
+	}
+}
+
+// whoisOther holds numerics we keep in WhoisInfo.Other.
+var whoisOther = map[string]struct{}{
+	"307": {}, // RPL_WHOISREGNICK
+	"310": {}, // RPL_WHOISHELPOP
+	"320": {}, // RPL_WHOISSPECIAL
+	"335": {}, // RPL_WHOISBOT
+	"378": {}, // RPL_WHOISHOST
+	"379": {}, // RPL_WHOISMODES
+}
+
+// Add processes a message.
+//
+// When the message is the RPL_ENDOFWHOIS we return the information and true.
+// Other messages give false.
+//
+// If the nick does not exist (ERR_NOSUCHNICK), we return a *NumericError
+// wrapping ErrNoSuchNick and true. We also return an error if a reply is
+// malformed.
+func (c *WhoisCollector) Add(m Message) (*WhoisInfo, bool, error) {
+	if c.done {
+		return nil, false, nil
+	}
+
+	// Every reply has the form <client> <nick> ...
+	if len(m.Params) < 2 || foldName(m.Params[1]) != foldName(c.nick) {
+		return nil, false, nil
+	}
+
+	info := c.info
+
+	switch m.Command {
+	case ReplyWhoisUser:
+		// <client> <nick> <username> <host> * :<realname>
+		if len(m.Params) != 6 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISUSER: %s", m)
+		}
+		info.Nick = m.Params[1]
+		info.User = m.Params[2]
+		info.Host = m.Params[3]
+		info.RealName = m.Params[5]
+	case ReplyWhoisServer:
+		// <client> <nick> <server> :<server info>
+		if len(m.Params) != 4 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISSERVER: %s", m)
+		}
+		info.Server = m.Params[2]
+		info.ServerInfo = m.Params[3]
+	case ReplyWhoisOperator:
+		info.Operator = true
+	case ReplyWhoisIdle:
+		// <client> <nick> <secs> [<signon>] :seconds idle, signon time
+		if len(m.Params) < 4 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISIDLE: %s", m)
+		}
+		idle, err := strconv.ParseInt(m.Params[2], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid idle time: %s", m)
+		}
+		info.Idle = time.Duration(idle) * time.Second
+
+		if len(m.Params) > 4 {
+			signOn, err := strconv.ParseInt(m.Params[3], 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid signon time: %s", m)
+			}
+			info.SignOn = time.Unix(signOn, 0)
+		}
+	case ReplyWhoisChannels:
+		// <client> <nick> :[prefix]<channel>{ [prefix]<channel>}
+		if len(m.Params) != 3 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISCHANNELS: %s", m)
+		}
+		for _, entry := range strings.Fields(m.Params[2]) {
+			info.Channels = append(info.Channels,
+				parseWhoisChannel(entry, c.prefixes))
+		}
+	case ReplyWhoisAccount:
+		// <client> <nick> <account> :is logged in as
+		if len(m.Params) != 4 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISACCOUNT: %s", m)
+		}
+		info.Account = m.Params[2]
+	case ReplyWhoisActually:
+		if len(m.Params) < 3 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISACTUALLY: %s", m)
+		}
+		c.parseActually(m)
+	case ReplyWhoisSecure:
+		info.Secure = true
+	case ReplyWhoisCertFP:
+		// <client> <nick> :has client certificate fingerprint <fingerprint>
+		if len(m.Params) != 3 {
+			return nil, false, fmt.Errorf("malformed RPL_WHOISCERTFP: %s", m)
+		}
+		fields := strings.Fields(m.Params[len(m.Params)-1])
+		if len(fields) > 0 {
+			info.CertFP = fields[len(fields)-1]
+		}
+	case ReplyAway:
+		// <client> <nick> :<message>
+		if len(m.Params) != 3 {
+			return nil, false, fmt.Errorf("malformed RPL_AWAY: %s", m)
+		}
+		info.Away = true
+		info.AwayMessage = m.Params[len(m.Params)-1]
+	case ReplyEndOfWhois:
+		c.done = true
+		return info, true, nil
+	case ErrorNoSuchNick:
+		c.done = true
+		return nil, true, NewNumericError(m)
+	default:
+		if _, ok := whoisOther[m.Command]; ok {
+			info.Other = append(info.Other, m)
+		}
+	}
+
+	return nil, false, nil
+}
+
+// parseActually parses an RPL_WHOISACTUALLY. Servers vary in what they send:
+//
+// <client> <nick> <ip> :Actually using host
+// <client> <nick> <host> :Actually using host
+// <client> <nick> <username>@<hostname> <ip> :Actually using host
+func (c *WhoisCollector) parseActually(m Message) {
+	args := m.Params[2:]
+	if len(args) > 1 {
+		args = args[:len(args)-1]
+	}
+	for _, arg := range args {
+		if idx := strings.IndexByte(arg, '@'); idx != -1 {
+			c.info.ActualHost = arg[idx+1:]
+			continue
+		}
+		if net.ParseIP(arg) != nil {
+			c.info.ActualIP = arg
+			continue
+		}
+		c.info.ActualHost = arg
+	}
+}
+
+// parseWhoisChannel parses a channel from RPL_WHOISCHANNELS, such as "@#test".
+//
+// Channel names may start with + which is also usually a prefix symbol. We
+// take the longest run of prefix symbols that leaves something that looks
+// like a channel name.
+func parseWhoisChannel(entry string, prefixes Prefixes) WhoisChannel {
+	end := 0
+	for i := 0; i < len(entry)-1 && prefixes.ModeFor(entry[i]) != 0; i++ {
+		if strings.IndexByte(channelTypes, entry[i+1]) != -1 {
+			end = i + 1
+		}
+	}
+
+	ch := WhoisChannel{Name: entry[end:], Symbols: entry[:end]}
+	for i := 0; i < end; i++ {
+		ch.Modes += string(prefixes.ModeFor(entry[i]))
+	}
+	return ch
+}
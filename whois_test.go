@@ -0,0 +1,119 @@
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWhoisCollector(t *testing.T) {
+	lines := []string{
+		":irc 311 me Alice ~alice example.com * :Alice A\r\n",
+		":irc 312 me Alice irc.example.com :Example server\r\n",
+		// Interleaved traffic that is not part of the WHOIS.
+		":bob!b@h PRIVMSG #test :hi\r\n",
+		":irc 311 me bob ~bob example.org * :Bob\r\n",
+		":irc 313 me Alice :is an IRC operator\r\n",
+		":irc 301 me Alice :gone fishing\r\n",
+		":irc 317 me Alice 120 1500000000 :seconds idle, signon time\r\n",
+		":irc 319 me Alice :@#test +#chat @+#ops +plus\r\n",
+		":irc 330 me Alice alice_acct :is logged in as\r\n",
+		":irc 338 me Alice ~alice@real.example.com 10.0.0.1 :Actually using host\r\n",
+		":irc 671 me Alice :is using a secure connection\r\n",
+		":irc 276 me Alice :has client certificate fingerprint abc123\r\n",
+		":irc 378 me Alice :is connecting from *@example.com 10.0.0.1\r\n",
+		":irc 318 me alice :End of /WHOIS list.\r\n",
+	}
+
+	c := NewWhoisCollector("alice", DefaultPrefixes)
+
+	var got *WhoisInfo
+	done := false
+	for _, line := range lines {
+		m, err := ParseMessage(line)
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) = %s", line, err)
+		}
+
+		if done {
+			t.Fatalf("collector finished before %q", line)
+		}
+
+		got, done, err = c.Add(m)
+		if err != nil {
+			t.Fatalf("Add(%s) = %s", m, err)
+		}
+	}
+
+	if !done {
+		t.Fatalf("collector did not finish")
+	}
+
+	other, err := ParseMessage(lines[12])
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) = %s", lines[12], err)
+	}
+
+	want := &WhoisInfo{
+		Nick:       "Alice",
+		User:       "~alice",
+		Host:       "example.com",
+		RealName:   "Alice A",
+		Server:     "irc.example.com",
+		ServerInfo: "Example server",
+		Operator:   true,
+		Idle:       120 * time.Second,
+		SignOn:     time.Unix(1500000000, 0),
+		Channels: []WhoisChannel{
+			{Name: "#test", Symbols: "@", Modes: "o"},
+			{Name: "#chat", Symbols: "+", Modes: "v"},
+			{Name: "#ops", Symbols: "@+", Modes: "ov"},
+			{Name: "+plus"},
+		},
+		Account:     "alice_acct",
+		Secure:      true,
+		CertFP:      "abc123",
+		ActualHost:  "real.example.com",
+		ActualIP:    "10.0.0.1",
+		Away:        true,
+		AwayMessage: "gone fishing",
+		Other:       []Message{other},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %+v, wanted %+v", got, want)
+	}
+}
+
+func TestWhoisCollectorNoSuchNick(t *testing.T) {
+	lines := []string{
+		":irc 401 me nobody :No such nick/channel\r\n",
+		":irc 318 me nobody :End of /WHOIS list.\r\n",
+	}
+
+	c := NewWhoisCollector("nobody", DefaultPrefixes)
+
+	m, err := ParseMessage(lines[0])
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) = %s", lines[0], err)
+	}
+
+	info, done, err := c.Add(m)
+	if !done || info != nil || !errors.Is(err, ErrNoSuchNick) {
+		t.Fatalf("Add(%s) = %v, %v, %v, wanted nil, true, ErrNoSuchNick", m,
+			info, done, err)
+	}
+
+	// The end of WHOIS that follows is ignored.
+	m, err = ParseMessage(lines[1])
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) = %s", lines[1], err)
+	}
+
+	info, done, err = c.Add(m)
+	if done || info != nil || err != nil {
+		t.Errorf("Add(%s) = %v, %v, %v, wanted nil, false, nil", m, info, done,
+			err)
+	}
+}